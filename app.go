@@ -0,0 +1,515 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dustin/go-humanize"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// The app is the full-screen UI of the root command: a list of backups with
+// details of the selected one, and keys to act on them, returning to the list
+// after each action.
+
+const (
+	// Output of autosave started from the app.
+	_autosaveLogFilename = "atss-autosave.log"
+	// How often the app checks whether autosave is running.
+	_appAutosaveStatusInterval = 3 * time.Second
+	// Number of recent messages shown.
+	_appMessagesShown = 3
+)
+
+type appMode int
+
+const (
+	_appBrowsing appMode = iota
+	_appEnteringSaveNote
+	_appEditingNote
+	_appConfirmingRestore
+	_appConfirmingDelete
+)
+
+type appAutosaveStatusMsg struct {
+	status *autosaveStatus
+}
+
+type appAutosaveTickMsg struct{}
+
+// appIndexModTimeMsg carries the modification time of the backup index, which
+// changes whenever backups are created, changed or deleted by any instance.
+type appIndexModTimeMsg time.Time
+
+type appTeaModel struct {
+	reportsCh <-chan autoBackupReport
+	messages  []autoBackupReport
+	noteInput textinput.Model
+
+	data     dashboardDataMsg
+	autosave *autosaveStatus
+	cursor   int
+	offset   int
+	width    int
+	height   int
+	mode     appMode
+	busy     bool
+}
+
+// runApp runs the app until the user quits.
+func runApp() error {
+	reportsCh := make(chan autoBackupReport, 16)
+	input := textinput.New()
+	input.CharLimit = 200
+	m := appTeaModel{
+		reportsCh: reportsCh,
+		noteInput: input,
+		width:     80,
+		height:    24,
+	}
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	// Log lines would garble the UI, so show them as messages instead.
+	log.SetOutput(autoBackupLogWriter{reportsCh})
+	defer log.SetOutput(os.Stderr)
+	_, err := p.Run()
+	return err
+}
+
+func appAutosaveTickCmd() tea.Cmd {
+	return tea.Tick(_appAutosaveStatusInterval, func(time.Time) tea.Msg { return appAutosaveTickMsg{} })
+}
+
+func checkAutosaveCmd() tea.Msg {
+	var status autosaveStatus
+	if err := callAutosave(http.MethodGet, "/status", nil, &status); err != nil {
+		return appAutosaveStatusMsg{}
+	}
+	return appAutosaveStatusMsg{&status}
+}
+
+func checkIndexModTimeCmd() tea.Msg {
+	return appIndexModTimeMsg(indexModTime())
+}
+
+func (m appTeaModel) Init() tea.Cmd {
+	return tea.Batch(reportListenCmd(m.reportsCh), loadDashboardDataCmd, checkAutosaveCmd, appAutosaveTickCmd())
+}
+
+func (m appTeaModel) selected() (Backup, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.data.backups) {
+		return Backup{}, false
+	}
+	return m.data.backups[m.cursor], true
+}
+
+func (m *appTeaModel) addMessage(kind autoBackupReportKind, message string) {
+	m.appendMessage(autoBackupReport{Time: time.Now(), Kind: kind, Message: message})
+}
+
+func (m *appTeaModel) appendMessage(r autoBackupReport) {
+	m.messages = append(m.messages, r)
+	if len(m.messages) > _dashboardReportsKept {
+		m.messages = m.messages[len(m.messages)-_dashboardReportsKept:]
+	}
+}
+
+func (m appTeaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m.quit()
+		}
+		switch m.mode {
+		case _appEnteringSaveNote, _appEditingNote:
+			return m.updateEnteringNote(msg)
+		case _appConfirmingRestore, _appConfirmingDelete:
+			return m.updateConfirming(msg)
+		default:
+			return m.updateBrowsing(msg)
+		}
+
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scrollToCursor()
+		return m, nil
+
+	case autoBackupReportMsg:
+		m.appendMessage(autoBackupReport(msg))
+		return m, reportListenCmd(m.reportsCh)
+
+	case appAutosaveTickMsg:
+		return m, tea.Batch(checkAutosaveCmd, checkIndexModTimeCmd, appAutosaveTickCmd())
+
+	case appIndexModTimeMsg:
+		// Pick up backups made by autosave or other AtSS instances.
+		if !time.Time(msg).Equal(m.data.indexModTime) {
+			return m, loadDashboardDataCmd
+		}
+		return m, nil
+
+	case appAutosaveStatusMsg:
+		m.autosave = msg.status
+		return m, nil
+
+	case dashboardDataMsg:
+		selected, ok := m.selected()
+		m.data = msg
+		m.cursor = 0
+		if ok {
+			for i, b := range m.data.backups {
+				if b.Dir == selected.Dir {
+					m.cursor = i
+					break
+				}
+			}
+		}
+		m.scrollToCursor()
+		return m, nil
+
+	case dashboardActionMsg:
+		m.busy = false
+		if msg.err != nil {
+			m.addMessage(_reportError, msg.err.Error())
+		} else if msg.message != "" {
+			m.addMessage(_reportInfo, msg.message)
+		}
+		return m, tea.Batch(loadDashboardDataCmd, checkAutosaveCmd)
+	}
+	return m, nil
+}
+
+// quit quits unless an action is in progress, since a restore or delete
+// interrupted by exiting would leave the saves or the backup half done.
+func (m appTeaModel) quit() (tea.Model, tea.Cmd) {
+	if m.busy {
+		m.addMessage(_reportInfo, "waiting for the current action to finish before quitting is possible")
+		return m, nil
+	}
+	return m, tea.Quit
+}
+
+func (m appTeaModel) updateBrowsing(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	backup, selected := m.selected()
+	switch msg.String() {
+	case "q":
+		return m.quit()
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.data.backups)-1 {
+			m.cursor++
+		}
+	case "pgup":
+		m.cursor = max(m.cursor-m.listHeight(), 0)
+	case "pgdown":
+		m.cursor = max(min(m.cursor+m.listHeight(), len(m.data.backups)-1), 0)
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = max(len(m.data.backups)-1, 0)
+	case "o":
+		if err := openDirectoryInExplorer(_eremiteGamesRootDirectory); err != nil {
+			m.addMessage(_reportError, err.Error())
+		}
+	}
+	if m.busy {
+		m.scrollToCursor()
+		return m, nil
+	}
+	switch msg.String() {
+	case "s":
+		m.mode = _appEnteringSaveNote
+		m.noteInput.Prompt = "Note for the new backup (optional): "
+		m.noteInput.SetValue("")
+		return m, m.noteInput.Focus()
+	case "n":
+		if selected {
+			m.mode = _appEditingNote
+			m.noteInput.Prompt = "Note: "
+			m.noteInput.SetValue(backup.Metadata.Note)
+			m.noteInput.CursorEnd()
+			return m, m.noteInput.Focus()
+		}
+	case "p":
+		if selected {
+			m.busy = true
+			return m, dashboardActionCmd(func() (string, error) {
+				backup, err := pinBackup(backup, !backup.Metadata.Pinned)
+				if err != nil {
+					return "", err
+				}
+				if backup.Metadata.Pinned {
+					return fmt.Sprintf("pinned %s", filepath.Base(backup.Dir)), nil
+				}
+				return fmt.Sprintf("unpinned %s", filepath.Base(backup.Dir)), nil
+			})
+		}
+	case "r":
+		if selected {
+			m.mode = _appConfirmingRestore
+		}
+	case "d":
+		if selected {
+			m.mode = _appConfirmingDelete
+		}
+	case "a":
+		m.busy = true
+		if m.autosave != nil {
+			return m, dashboardActionCmd(func() (string, error) {
+				if err := callAutosave(http.MethodPost, "/stop", nil, nil); err != nil {
+					return "", err
+				}
+				return "stopped autosave", nil
+			})
+		}
+		return m, dashboardActionCmd(func() (string, error) {
+			if err := startAutosaveProcess(); err != nil {
+				return "", err
+			}
+			// Give it a moment to start listening for control requests.
+			time.Sleep(time.Second)
+			return fmt.Sprintf("started autosave in the background, logging to %s", _autosaveLogFilename), nil
+		})
+	}
+	m.scrollToCursor()
+	return m, nil
+}
+
+func (m appTeaModel) updateEnteringNote(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.mode = _appBrowsing
+		m.noteInput.Blur()
+		return m, nil
+	case "enter":
+		mode := m.mode
+		m.mode = _appBrowsing
+		m.noteInput.Blur()
+		note := strings.TrimSpace(m.noteInput.Value())
+		if mode == _appEnteringSaveNote {
+			m.busy = true
+			return m, dashboardActionCmd(func() (string, error) {
+				backup, err := createBackup(BackupMetadata{Note: note})
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("created backup %s", filepath.Base(backup.Dir)), nil
+			})
+		}
+		backup, ok := m.selected()
+		if !ok {
+			return m, nil
+		}
+		m.busy = true
+		return m, dashboardActionCmd(func() (string, error) {
+			if _, err := annotateBackup(backup, note); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("updated note of %s", filepath.Base(backup.Dir)), nil
+		})
+	}
+	var cmd tea.Cmd
+	m.noteInput, cmd = m.noteInput.Update(msg)
+	return m, cmd
+}
+
+func (m appTeaModel) updateConfirming(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	mode := m.mode
+	m.mode = _appBrowsing
+	backup, ok := m.selected()
+	if msg.String() != "y" || !ok {
+		return m, nil
+	}
+	m.busy = true
+	if mode == _appConfirmingDelete {
+		return m, dashboardActionCmd(func() (string, error) {
+			if err := deleteBackup(backup); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted backup %s", filepath.Base(backup.Dir)), nil
+		})
+	}
+	return m, dashboardActionCmd(func() (string, error) {
+		autoBackup, err := restoreBackup(backup, restoreScope{})
+		if errors.Is(err, _errGameIsRunningRestoreRefused) {
+			return "", fmt.Errorf("%w; exit the game first, or use 'AtSS restore %s --wait'", err, filepath.Base(backup.Dir))
+		} else if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("restored %s, previous state backed up to %s",
+			filepath.Base(backup.Dir), filepath.Base(autoBackup.Dir)), nil
+	})
+}
+
+// listHeight is the number of backups shown at once.
+func (m appTeaModel) listHeight() int {
+	// Title, blank line, messages, prompt, status bar and help.
+	return max(m.height-5-_appMessagesShown, 3)
+}
+
+func (m *appTeaModel) scrollToCursor() {
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if h := m.listHeight(); m.cursor >= m.offset+h {
+		m.offset = m.cursor - h + 1
+	}
+}
+
+func (m appTeaModel) View() string {
+	faint := lipgloss.NewStyle().Faint(true)
+	bar := lipgloss.NewStyle().Reverse(true).Width(m.width)
+	var sb strings.Builder
+
+	sb.WriteString(lipgloss.NewStyle().Bold(true).Render("Against the Storm Save Scummer"))
+	sb.WriteString("\n\n")
+
+	listWidth := max(m.width*3/5, 20)
+	var list strings.Builder
+	for i := m.offset; i < len(m.data.backups) && i < m.offset+m.listHeight(); i++ {
+		line := "  " + m.data.backups[i].String()
+		if i == m.cursor {
+			line = "> " + m.data.backups[i].String()
+		}
+		if m.data.backups[i].Metadata.IsAutoSave && i != m.cursor {
+			line = faint.Render(line)
+		}
+		list.WriteString(lipgloss.NewStyle().MaxWidth(listWidth).Render(line))
+		list.WriteString("\n")
+	}
+	if len(m.data.backups) == 0 {
+		list.WriteString(faint.Render("No backups yet, press s to save the current state."))
+	}
+	var details string
+	if backup, ok := m.selected(); ok {
+		details = describeBackupDetails(backup)
+	}
+	detailsStyle := lipgloss.NewStyle().
+		Width(max(m.width-listWidth-3, 10)).
+		MaxHeight(m.listHeight()).
+		PaddingLeft(1).
+		Border(lipgloss.NormalBorder(), false, false, false, true)
+	panes := lipgloss.JoinHorizontal(lipgloss.Top,
+		lipgloss.NewStyle().Width(listWidth).Height(m.listHeight()).MaxHeight(m.listHeight()).Render(list.String()),
+		detailsStyle.Render(details))
+	sb.WriteString(panes)
+	sb.WriteString("\n")
+
+	messages := m.messages[max(len(m.messages)-_appMessagesShown, 0):]
+	for _, r := range messages {
+		sb.WriteString(lipgloss.NewStyle().MaxWidth(m.width).Render(r.render()))
+		sb.WriteString("\n")
+	}
+	for i := len(messages); i < _appMessagesShown; i++ {
+		sb.WriteString("\n")
+	}
+
+	switch m.mode {
+	case _appEnteringSaveNote, _appEditingNote:
+		sb.WriteString(m.noteInput.View())
+	case _appConfirmingRestore:
+		backup, _ := m.selected()
+		fmt.Fprintf(&sb, "Restore %s? An auto backup of the current save is created first. (y/N)", backup)
+	case _appConfirmingDelete:
+		backup, _ := m.selected()
+		if backup.Metadata.Pinned {
+			fmt.Fprintf(&sb, "Delete %s? It's pinned. (y/N)", backup)
+		} else {
+			fmt.Fprintf(&sb, "Delete %s? (y/N)", backup)
+		}
+	default:
+		if m.busy {
+			sb.WriteString(faint.Render("Working..."))
+		}
+	}
+	sb.WriteString("\n")
+
+	autosave := "Autosave: off"
+	if m.autosave != nil {
+		autosave = fmt.Sprintf("Autosave: on (PID %d)", m.autosave.PID)
+		if m.autosave.Paused {
+			autosave = fmt.Sprintf("Autosave: paused (PID %d)", m.autosave.PID)
+		}
+	}
+	status := fmt.Sprintf("Current: %s | %d backups, %s | %s",
+		m.data.season, len(m.data.backups), humanize.Bytes(uint64(m.data.diskUsage)), autosave)
+	if m.data.err != nil {
+		status += fmt.Sprintf(" | %s", m.data.err)
+	}
+	sb.WriteString(bar.Render(status))
+	sb.WriteString("\n")
+	sb.WriteString(faint.Render("↑/↓ select • s save • r restore • d delete • n note • p pin • o open folder • a autosave on/off • q quit"))
+	return sb.String()
+}
+
+// describeBackupDetails lists the metadata of a backup for the details pane.
+func describeBackupDetails(b Backup) string {
+	var sb strings.Builder
+	md := b.Metadata
+	fmt.Fprintf(&sb, "%s\n\n", filepath.Base(b.Dir))
+	fmt.Fprintf(&sb, "Created: %s\n", md.CreatedAt.Format("2006-01-02 15:04:05"))
+	if md.Season != nil {
+		fmt.Fprintf(&sb, "Season:  %s\n", *md.Season)
+	}
+	fmt.Fprintf(&sb, "Origin:  %s\n", md.Origin)
+	if md.Pinned {
+		sb.WriteString("Pinned\n")
+	}
+	if md.Note != "" {
+		fmt.Fprintf(&sb, "Note:    %s\n", md.Note)
+	}
+	if md.Parent != "" {
+		fmt.Fprintf(&sb, "Parent:  %s\n", md.Parent)
+	}
+	if md.Session != nil {
+		fmt.Fprintf(&sb, "Session: started %s\n", md.Session.StartedAt.Format("2006-01-02 15:04:05"))
+	}
+	if len(md.Events) > 0 {
+		sb.WriteString("\nEvents:\n")
+		for _, e := range md.Events {
+			fmt.Fprintf(&sb, "  %s %s\n", e.Time.Format("15:04:05"), e.Description)
+		}
+	}
+	if len(md.Files) > 0 {
+		sb.WriteString("\nFiles:\n")
+		for _, f := range md.Files {
+			fmt.Fprintf(&sb, "  %s (%s)\n", f.Name, humanize.Bytes(uint64(f.Size)))
+		}
+	}
+	return sb.String()
+}
+
+// startAutosaveProcess starts headless autosave as a separate process, which
+// keeps running after the app exits. Its output goes to a log file in the
+// backups root directory.
+func startAutosaveProcess() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	file := filepath.Join(_backupsDirectory, _autosaveLogFilename)
+	out, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open autosave log '%s': %w", file, err)
+	}
+	defer out.Close()
+	cmd := exec.Command(executable, "autosave", "--headless")
+	cmd.Stdout, cmd.Stderr = out, out
+	detachProcess(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start autosave: %w", err)
+	}
+	return cmd.Process.Release()
+}
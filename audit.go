@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// Every attempt to create, restore or delete a backup is appended to this file
+// in the backups root directory as a JSON line, whatever the outcome, by any
+// AtSS instance. Nothing ever rewrites it.
+const _auditLogFilename = "atss-audit.jsonl"
+
+type auditAction string
+
+const (
+	_auditCreate  auditAction = "create"
+	_auditRestore auditAction = "restore"
+	_auditDelete  auditAction = "delete"
+)
+
+type auditEntry struct {
+	Time   time.Time   `json:"time"`
+	Action auditAction `json:"action"`
+	// Dirname of the backup; empty if creating failed before it was named.
+	Backup  string       `json:"backup,omitempty"`
+	Origin  BackupOrigin `json:"origin,omitempty"`
+	Outcome string       `json:"outcome"`
+	Error   string       `json:"error,omitempty"`
+	PID     int          `json:"pid"`
+}
+
+// audit records the outcome of action on backup, failed if err is non-nil.
+// Failing to record it is only warned about, as the action is already done.
+func audit(action auditAction, backup Backup, err error) {
+	entry := auditEntry{
+		Time:    time.Now(),
+		Action:  action,
+		Origin:  backup.Metadata.Origin,
+		Outcome: "ok",
+		PID:     os.Getpid(),
+	}
+	if backup.Dir != "" {
+		entry.Backup = filepath.Base(backup.Dir)
+	}
+	if err != nil {
+		entry.Outcome = "failed"
+		entry.Error = err.Error()
+	}
+	if appendErr := appendJSONLines(filepath.Join(_backupsDirectory, _auditLogFilename), entry); appendErr != nil {
+		log.Warnf("failed to write audit log: %s", appendErr)
+	}
+}
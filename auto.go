@@ -1,153 +1,659 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/lipgloss"
-	"github.com/fsnotify/fsnotify"
 	"github.com/zmwangx/debounce"
-	"golang.org/x/sys/windows"
 
 	"github.com/fanaticscripter/AtSS/log"
 )
 
-const _autoBackupMutexName = "AtSS_autoBackupMutex"
+type autoBackupReportKind int
 
-type autoBackupDisplayMsg string
+const (
+	_reportInfo autoBackupReportKind = iota
+	_reportEvent
+	_reportSkipped
+	_reportBackup
+	_reportError
+	// Log lines, already formatted.
+	_reportLog
+)
 
-type autoBackupTeaModel struct {
-	displayMessagesCh <-chan string
-	displayMessages   []autoBackupDisplayMsg
-	spinner           spinner.Model
-	quitting          bool
+func (k autoBackupReportKind) String() string {
+	switch k {
+	case _reportInfo:
+		return "info"
+	case _reportEvent:
+		return "event"
+	case _reportSkipped:
+		return "skipped"
+	case _reportBackup:
+		return "backup"
+	case _reportError:
+		return "error"
+	case _reportLog:
+		return "log"
+	default:
+		return fmt.Sprintf("autoBackupReportKind(%d)", int(k))
+	}
 }
 
-func autoBackupInitialModel(displayMessagesCh <-chan string) autoBackupTeaModel {
-	s := spinner.New()
-	s.Spinner = spinner.Dot
-	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
-	return autoBackupTeaModel{
-		displayMessagesCh: displayMessagesCh,
-		spinner:           s,
-	}
+// autoBackupReport is a message from the daemon about what it's doing.
+type autoBackupReport struct {
+	Time    time.Time
+	Kind    autoBackupReportKind
+	Message string
+	Fields  log.Fields
+	// The backup created, for _reportBackup.
+	Backup *Backup
+}
+
+// autoBackupReporter presents reports: in the TUI, or as log lines when
+// running headless.
+type autoBackupReporter interface {
+	report(r autoBackupReport)
+	setGameStatus(status string)
 }
 
-func displayMessageListenCmd(ch <-chan string) tea.Cmd {
-	// The command waits for and returns the next message from the channel.
-	return func() tea.Msg {
-		return autoBackupDisplayMsg(<-ch)
+type autoBackupLogReporter struct{}
+
+func (autoBackupLogReporter) report(r autoBackupReport) {
+	entry := log.WithFields(r.Fields)
+	if r.Kind == _reportError {
+		entry.Error(r.Message)
+	} else {
+		entry.Info(r.Message)
 	}
 }
 
-func (m autoBackupTeaModel) Init() tea.Cmd {
-	return tea.Batch(displayMessageListenCmd(m.displayMessagesCh), m.spinner.Tick)
+// Game status changes are reported as messages as well.
+func (autoBackupLogReporter) setGameStatus(string) {}
+
+// autoBackupJSONReporter prints reports to stdout as JSON lines, for
+// --output json.
+type autoBackupJSONReporter struct {
+	mu sync.Mutex
+}
+
+type autoBackupJSONReport struct {
+	Time    time.Time      `json:"time"`
+	Kind    string         `json:"kind"`
+	Message string         `json:"message"`
+	Fields  map[string]any `json:"fields,omitempty"`
+	Backup  *apiBackup     `json:"backup,omitempty"`
 }
 
-func (m autoBackupTeaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c":
-			m.quitting = true
-			return m, tea.Quit
-		default:
-			return m, nil
+func (r *autoBackupJSONReporter) report(report autoBackupReport) {
+	line := autoBackupJSONReport{
+		Time:    report.Time,
+		Kind:    report.Kind.String(),
+		Message: report.Message,
+	}
+	if len(report.Fields) > 0 {
+		line.Fields = make(map[string]any, len(report.Fields))
+		for k, v := range report.Fields {
+			// Errors and durations don't encode usefully as is.
+			switch v := v.(type) {
+			case error:
+				line.Fields[k] = v.Error()
+			case time.Duration:
+				line.Fields[k] = v.String()
+			default:
+				line.Fields[k] = v
+			}
 		}
+	}
+	if report.Backup != nil {
+		backup := newAPIBackup(*report.Backup)
+		line.Backup = &backup
+	}
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		log.Errorf("failed to encode report: %s", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Println(string(encoded))
+}
 
-	case autoBackupDisplayMsg:
-		m.displayMessages = append(m.displayMessages, msg)
-		return m, displayMessageListenCmd(m.displayMessagesCh)
+func (*autoBackupJSONReporter) setGameStatus(string) {}
 
-	default:
-		var cmd tea.Cmd
-		m.spinner, cmd = m.spinner.Update(msg)
-		return m, cmd
+const (
+	_defaultAutoBackupDebounce = 5 * time.Second
+	_defaultAutoBackupMaxWait  = 30 * time.Second
+)
+
+// autoBackupOptions configures autosave; see AutosaveConfig.
+type autoBackupOptions struct {
+	Triggers []string
+	EveryN   int
+	// Save updates are debounced by Debounce, delaying up to MaxWait.
+	Debounce time.Duration
+	MaxWait  time.Duration
+	// If positive, wait for the save files to be unchanged for this long
+	// instead of debouncing, still delaying up to MaxWait.
+	StableFor   time.Duration
+	MinInterval time.Duration
+	MaxPerHour  int
+	// If positive, also take scheduled snapshots on this interval while the
+	// game is running.
+	Interval time.Duration
+	// Run without the TUI, logging to stderr instead.
+	Headless bool
+}
+
+// autoBackupDaemon handles debounced save updates, detecting events and
+// consulting the policy to decide whether to back up.
+type autoBackupDaemon struct {
+	policy    autoBackupPolicy
+	options   autoBackupOptions
+	startedAt time.Time
+	reporter  autoBackupReporter
+	// Queues a save update, and flushes the pending save update, if any.
+	queueSaveUpdate func()
+	flushSaveUpdate func()
+
+	// mu guards the fields below.
+	mu           sync.Mutex
+	lastState    *autoBackupState
+	lastSnapshot saveSnapshot
+	updates      int
+	// Events detected since the last backup, to be attached to the next one.
+	pendingEvents []SaveEvent
+	// Current play session, nil if the game isn't running.
+	session *GameSession
+	// Dirname of the last backup restored by another AtSS instance, recorded
+	// as the parent of the next backup.
+	parent string
+	// Hash of the save restored by that backup, which needn't be backed up
+	// again; cleared along with parent.
+	restoredHash string
+	lastBackup   *Backup
+	throttle     autoBackupThrottle
+	// Set while a throttled save update is scheduled.
+	throttleTimer *time.Timer
+	// Set when the throttled save update is queued again, which doesn't count
+	// as another update.
+	requeued bool
+
+	// Save updates are ignored while paused.
+	paused atomic.Bool
+}
+
+func (d *autoBackupDaemon) report(kind autoBackupReportKind, message string, fields log.Fields) {
+	d.reporter.report(autoBackupReport{Time: time.Now(), Kind: kind, Message: message, Fields: fields})
+}
+
+func (d *autoBackupDaemon) reportBackup(backup Backup, reason string) {
+	fields := log.Fields{
+		"backup": filepath.Base(backup.Dir),
+		"reason": reason,
+	}
+	if backup.retries > 0 {
+		reason += fmt.Sprintf(", after %d retries", backup.retries)
+		fields["retries"] = backup.retries
 	}
+	d.reporter.report(autoBackupReport{
+		Time:    time.Now(),
+		Kind:    _reportBackup,
+		Message: fmt.Sprintf("created backup: %s (%s)", backup, reason),
+		Fields:  fields,
+		Backup:  &backup,
+	})
 }
 
-func (m autoBackupTeaModel) View() string {
-	var sb strings.Builder
-	for _, m := range m.displayMessages {
-		sb.WriteString(string(m))
-		sb.WriteString("\n")
+func (d *autoBackupDaemon) handleSaveUpdate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	requeued := d.requeued
+	d.requeued = false
+	if d.paused.Load() {
+		d.report(_reportSkipped, "ignored save update: paused", nil)
+		return
 	}
-	fmt.Fprintf(&sb, "\n%s Waiting for updated save...\n", m.spinner.View())
-	if m.quitting {
-		sb.WriteString("\n")
+	snapshot, err := takeSaveSnapshot(_savesDirectory)
+	if err != nil {
+		d.report(_reportError, fmt.Sprintf("failed to read save state: %s", err), log.Fields{"error": err})
+	}
+	state := autoBackupState{Season: snapshot.Save.SeasonId()}
+	log.Debugf("processing save update %d: season %s", d.updates+1, state.Season)
+	d.acceptRestoreMarker()
+	if d.restoredHash != "" {
+		if hash, err := hashSave(_savesDirectory); err == nil && hash == d.restoredHash {
+			// The update is the restore itself, which is already backed up.
+			// Start afresh from the restored state, so that nothing is
+			// detected across the restore.
+			state.Updates = d.updates
+			d.lastState = &state
+			d.lastSnapshot = snapshot
+			d.pendingEvents = nil
+			return
+		}
+	}
+	// The initial backup upon startup is unconditional, and doesn't count as
+	// an update.
+	shouldBackup, reason := true, "initial backup"
+	if d.lastState != nil {
+		if !requeued {
+			d.updates++
+		}
+		state.Updates = d.updates
+		shouldBackup, reason = d.policy.decide(d.lastState, state)
+		log.Debugf("policy decided to back up: %t (%s)", shouldBackup, reason)
+
+		events := detectSaveEvents(d.lastSnapshot, snapshot, now)
+		for _, e := range events {
+			d.report(_reportEvent, e.Description, log.Fields{"event": e.Type})
+		}
+		if len(events) > 0 {
+			if err := appendEventLog(events); err != nil {
+				log.Warn(err)
+			}
+			d.pendingEvents = append(d.pendingEvents, events...)
+		}
+	}
+	d.lastSnapshot = snapshot
+	if shouldBackup {
+		if wait, throttleReason := d.throttle.wait(now); wait > 0 {
+			// Keep the last state, so that the policy decides the same way
+			// when the update is processed again once allowed.
+			d.report(_reportSkipped, fmt.Sprintf("postponed backup by %s: %s", wait.Round(time.Second), throttleReason),
+				log.Fields{"reason": throttleReason, "wait": wait})
+			if d.throttleTimer == nil {
+				d.throttleTimer = time.AfterFunc(wait, func() {
+					d.mu.Lock()
+					d.throttleTimer = nil
+					d.requeued = true
+					d.mu.Unlock()
+					d.queueSaveUpdate()
+				})
+			}
+			return
+		}
+	}
+	d.lastState = &state
+	if !shouldBackup {
+		d.report(_reportSkipped, fmt.Sprintf("skipped backup: %s", reason), log.Fields{"reason": reason})
+		return
+	}
+
+	backup, err := createBackup(BackupMetadata{
+		IsAutoSave: true,
+		Season:     &state.Season,
+		Note:       describeSaveEvents(d.pendingEvents),
+		Events:     d.pendingEvents,
+		Session:    d.session,
+		Parent:     d.parent,
+	})
+	if err != nil {
+		d.report(_reportError, fmt.Sprintf("failed to create auto backup: %s", err), log.Fields{"error": err})
+	} else {
+		d.pendingEvents = nil
+		d.parent, d.restoredHash = "", ""
+		d.lastBackup = &backup
+		d.throttle.record(now)
+		d.reportBackup(backup, reason)
 	}
-	return sb.String()
 }
 
-func startAutoBackups() {
-	// Make sure only one instance of autobackup runs.
-	_, err := windows.CreateMutex(nil, false, windows.StringToUTF16Ptr(_autoBackupMutexName))
+// acceptRestoreMarker consumes the marker left by a restore from another AtSS
+// instance, if any, so that the restored save isn't backed up again, and the
+// next backup is linked to the restored one. d.mu must be held.
+func (d *autoBackupDaemon) acceptRestoreMarker() {
+	marker, ok := takeRestoreMarker()
+	if !ok {
+		return
+	}
+	d.report(_reportInfo, fmt.Sprintf("restored %s", marker.Backup), log.Fields{"backup": marker.Backup})
+	d.parent = marker.Backup
+	d.restoredHash = marker.Hash
+}
+
+// isBackedUp reports whether a save with the given hash was just backed up or
+// restored. d.mu must be held.
+func (d *autoBackupDaemon) isBackedUp(hash string) bool {
+	return hash == d.restoredHash || (d.lastBackup != nil && d.lastBackup.Metadata.Hash == hash)
+}
+
+// handleGameProcessEvent tracks play sessions, and backs up the final state
+// of a session when the game exits.
+func (d *autoBackupDaemon) handleGameProcessEvent(e gameProcessEvent) {
+	session := e.Session
+	if e.running() {
+		d.mu.Lock()
+		d.session = &session
+		d.mu.Unlock()
+		d.reporter.setGameStatus(fmt.Sprintf("Game: running since %s", session.StartedAt.Format("15:04:05")))
+		d.report(_reportInfo, "game started", nil)
+		return
+	}
+
+	d.reporter.setGameStatus(fmt.Sprintf("Game: not running (last session %s - %s)",
+		session.StartedAt.Format("15:04:05"), session.EndedAt.Format("15:04:05")))
+	d.report(_reportInfo, "game exited", log.Fields{"session": session.EndedAt.Sub(session.StartedAt).Round(time.Second)})
+	if err := appendSessionLog(session); err != nil {
+		log.Warn(err)
+	}
+	// Process the final save update of the session first, if still pending.
+	d.flushSaveUpdate()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.session = nil
+	if d.paused.Load() {
+		return
+	}
+	var hash string
+	if _, err := _saveFileRetryPolicy.do("hashing save", func() (err error) {
+		hash, err = hashSave(_savesDirectory)
+		return
+	}); err != nil {
+		log.Warnf("failed to hash save: %s", err)
+	}
+	// Usually the final save update was just backed up.
+	d.acceptRestoreMarker()
+	if hash != "" && d.isBackedUp(hash) {
+		d.report(_reportSkipped, "skipped game exit backup: save unchanged since the last backup or restore", nil)
+		return
+	}
+	note := "game exited"
+	if len(d.pendingEvents) > 0 {
+		note += "; " + describeSaveEvents(d.pendingEvents)
+	}
+	backup, err := createBackup(BackupMetadata{
+		IsAutoSave: true,
+		Hash:       hash,
+		Note:       note,
+		Events:     d.pendingEvents,
+		Session:    &session,
+		Parent:     d.parent,
+	})
 	if err != nil {
-		if err == windows.ERROR_ALREADY_EXISTS {
-			displayWarning("Another instance of autobackup is already running. Exiting.")
+		d.report(_reportError, fmt.Sprintf("failed to create game exit backup: %s", err), log.Fields{"error": err})
+		return
+	}
+	d.pendingEvents = nil
+	d.parent, d.restoredHash = "", ""
+	d.lastBackup = &backup
+	d.reportBackup(backup, "end of session")
+}
+
+// runScheduler takes scheduled snapshots until ctx is done.
+func (d *autoBackupDaemon) runScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
 			return
-		} else {
-			log.Warnf("failed to create mutex %s, cannot determine if autobackup is already running: %s", _autoBackupMutexName, err)
+		case <-ticker.C:
+			d.takeScheduledSnapshot()
 		}
 	}
+}
 
-	displayNotice("This program will now watch for changes to the game save, and automatically back up when a change is detected. " +
-		"There is a few seconds' delay for each update.\n\n" +
-		"Please keep this window open.")
+// takeScheduledSnapshot backs up while the game is running, as a safety net
+// for missed save updates, unless the save is unchanged since the last backup,
+// or is still being written, in which case the save update is processed
+// anyway. Throttling doesn't apply.
+func (d *autoBackupDaemon) takeScheduledSnapshot() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.session == nil || d.paused.Load() {
+		return
+	}
+	// Like save updates, wait for the save files to settle, lest we back up a
+	// save written halfway.
+	settle := d.options.Debounce
+	if d.options.StableFor > 0 {
+		settle = d.options.StableFor
+	}
+	for _, f := range statSaveFiles(_savesDirectory) {
+		if time.Since(f.ModTime) < settle {
+			d.report(_reportSkipped, "skipped scheduled snapshot: save files are being written", nil)
+			return
+		}
+	}
+	var hash string
+	_, err := _saveFileRetryPolicy.do("hashing save", func() (err error) {
+		hash, err = hashSave(_savesDirectory)
+		return
+	})
+	if err != nil {
+		d.report(_reportError, fmt.Sprintf("failed to take scheduled snapshot: %s", err), log.Fields{"error": err})
+		return
+	}
+	d.acceptRestoreMarker()
+	if d.isBackedUp(hash) {
+		d.report(_reportSkipped, "skipped scheduled snapshot: save unchanged since the last backup or restore", nil)
+		return
+	}
+	note := "scheduled snapshot"
+	if len(d.pendingEvents) > 0 {
+		note += "; " + describeSaveEvents(d.pendingEvents)
+	}
+	backup, err := createBackup(BackupMetadata{
+		IsAutoSave: true,
+		Origin:     _originScheduled,
+		Hash:       hash,
+		Note:       note,
+		Events:     d.pendingEvents,
+		Session:    d.session,
+		Parent:     d.parent,
+	})
+	if err != nil {
+		d.report(_reportError, fmt.Sprintf("failed to take scheduled snapshot: %s", err), log.Fields{"error": err})
+		return
+	}
+	d.pendingEvents = nil
+	d.parent, d.restoredHash = "", ""
+	d.lastBackup = &backup
+	// The policy decides on the next save update relative to the snapshot.
+	if backup.Metadata.Season != nil {
+		d.lastState = &autoBackupState{Season: *backup.Metadata.Season, Updates: d.updates}
+	}
+	d.reportBackup(backup, "scheduled")
+}
 
-	watcher, err := fsnotify.NewWatcher()
+// backupNow creates a backup on request, regardless of the policy, with
+// pending events attached.
+func (d *autoBackupDaemon) backupNow(note string) (backup Backup, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if note == "" {
+		note = describeSaveEvents(d.pendingEvents)
+	}
+	backup, err = createBackup(BackupMetadata{
+		Note:    note,
+		Events:  d.pendingEvents,
+		Session: d.session,
+		Parent:  d.parent,
+	})
 	if err != nil {
-		log.Fatalf("failed to create filesystem watcher: %s", err)
+		d.report(_reportError, fmt.Sprintf("failed to create requested backup: %s", err), log.Fields{"error": err})
 		return
 	}
-	defer watcher.Close()
+	d.pendingEvents = nil
+	d.parent, d.restoredHash = "", ""
+	d.lastBackup = &backup
+	d.reportBackup(backup, "requested")
+	return
+}
+
+func (d *autoBackupDaemon) setPaused(paused bool) {
+	if d.paused.Swap(paused) == paused {
+		return
+	}
+	action := "resumed"
+	if paused {
+		action = "paused"
+	}
+	d.report(_reportInfo, action, nil)
+}
+
+func (d *autoBackupDaemon) isPaused() bool {
+	return d.paused.Load()
+}
+
+// finish processes the pending save update, if any, and waits for a backup in
+// flight.
+func (d *autoBackupDaemon) finish() {
+	d.flushSaveUpdate()
+	d.mu.Lock()
+	d.mu.Unlock()
+}
 
-	displayMessagesCh := make(chan string, 1)
+func (d *autoBackupDaemon) status() autosaveStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := autosaveStatus{
+		PID:           os.Getpid(),
+		StartedAt:     d.startedAt,
+		Paused:        d.paused.Load(),
+		Triggers:      d.options.Triggers,
+		Updates:       d.updates,
+		PendingEvents: len(d.pendingEvents),
+		Session:       d.session,
+	}
+	if d.lastBackup != nil {
+		b := newAPIBackup(*d.lastBackup)
+		status.LastBackup = &b
+	}
+	return status
+}
+
+func startAutoBackups(options autoBackupOptions) {
+	policy, err := newAutoBackupPolicy(options.Triggers, options.EveryN)
+	if err != nil {
+		fail(fmt.Errorf("%w: %w", _errUsage, err))
+	}
+	if options.StableFor <= 0 && options.Debounce <= 0 {
+		fail(fmt.Errorf("%w: autosave debounce must be positive", _errUsage))
+	}
+
+	// Make sure only one instance of autobackup runs.
+	lock, err := tryLock(_autosaveLockFilename)
+	if err != nil {
+		if errors.Is(err, _errLockHeld) {
+			if options.Headless {
+				fail(fmt.Errorf("another instance of autobackup is already running: %w", err))
+			}
+			displayWarning(fmt.Sprintf("Another instance of autobackup is already running (%s). Exiting.", err))
+			return
+		}
+		log.Warnf("cannot determine if autobackup is already running: %s", err)
+	} else {
+		defer func() {
+			if err := lock.release(); err != nil {
+				log.Warn(err)
+			}
+		}()
+	}
+
+	if options.Headless {
+		log.WithFields(log.Fields{"saves": _savesDirectory, "triggers": options.Triggers}).Info("watching for save updates")
+	}
+
+	reportsCh := make(chan autoBackupReport, 16)
+	gameStatusCh := make(chan string, 1)
+	var reporter autoBackupReporter = autoBackupTUIReporter{reportsCh, gameStatusCh}
+	if jsonOutput() {
+		reporter = &autoBackupJSONReporter{}
+	} else if options.Headless {
+		reporter = autoBackupLogReporter{}
+	}
+	daemon := &autoBackupDaemon{
+		policy:    policy,
+		options:   options,
+		startedAt: time.Now(),
+		reporter:  reporter,
+		throttle: autoBackupThrottle{
+			minInterval: options.MinInterval,
+			maxPerHour:  options.MaxPerHour,
+		},
+	}
 	// We debounce the backup operation, because sometimes multiple save files
 	// need to be updated, and even when only a single one changes, it may not
 	// be written atomically, so multiple write events can fire in quick
 	// succession.
-	performBackup, _ := debounce.Debounce(func() {
-		backup, err := createBackup(BackupMetadata{
-			IsAutoSave: true,
-		})
-		if err != nil {
-			now := time.Now()
-			displayMessagesCh <- colored(_red, fmt.Sprintf("[%s] failed to create auto backup: %s", now.Format("2006-01-02 15:04:05"), err))
-		} else {
-			displayMessagesCh <- fmt.Sprintf("created backup: %s", backup)
-		}
-	}, 5*time.Second, debounce.WithMaxWait(30*time.Second))
-	performBackup() // Perform a backup upon startup
+	if options.StableFor > 0 {
+		stabilizer := newSaveStabilizer(daemon.handleSaveUpdate, _savesDirectory, options.StableFor, options.MaxWait)
+		daemon.queueSaveUpdate, daemon.flushSaveUpdate = stabilizer.trigger, stabilizer.flush
+	} else {
+		performBackup, control := debounce.Debounce(daemon.handleSaveUpdate, options.Debounce, debounce.WithMaxWait(options.MaxWait))
+		daemon.queueSaveUpdate, daemon.flushSaveUpdate = performBackup, control.Flush
+	}
+	performBackup := daemon.queueSaveUpdate
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reporter.setGameStatus("Game: not running")
+	gameProcessEvents := monitorGameProcess(ctx, _gameMonitorInterval)
 	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					performBackup()
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				log.Errorf("filesystem watcher error: %s", err)
-			}
+		for e := range gameProcessEvents {
+			daemon.handleGameProcessEvent(e)
 		}
 	}()
-
-	err = watcher.Add(_savesDirectory)
+	if options.Interval > 0 {
+		go daemon.runScheduler(ctx, options.Interval)
+	}
+	watcher, err := newSaveWatcher(_savesDirectory, performBackup)
 	if err != nil {
-		log.Fatalf("failed to watch saves directory '%s': %s", _savesDirectory, err)
+		log.Fatal(err)
 	}
+	defer watcher.Close()
+	go watcher.run(ctx)
 
-	p := tea.NewProgram(autoBackupInitialModel(displayMessagesCh))
-	if _, err := p.Run(); err != nil {
+	if options.Headless {
+		runAutoBackupsHeadless(ctx, daemon, performBackup)
+		return
+	}
+
+	performBackup() // Perform a backup upon startup
+	p := tea.NewProgram(autoBackupInitialModel(daemon, reportsCh, gameStatusCh), tea.WithAltScreen())
+	shutdownControl, err := serveAutosaveControl(daemon, func() { p.Send(dashboardStopMsg{}) })
+	if err != nil {
+		log.Warnf("autosave can't be controlled from other AtSS invocations: %s", err)
+	} else {
+		defer shutdownControl()
+	}
+	// Log lines would garble the dashboard, so show them as reports instead.
+	log.SetOutput(autoBackupLogWriter{reportsCh})
+	_, err = p.Run()
+	log.SetOutput(os.Stderr)
+	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+// runAutoBackupsHeadless runs until interrupted, terminated, or stopped via
+// the control endpoint.
+func runAutoBackupsHeadless(ctx context.Context, daemon *autoBackupDaemon, performBackup func()) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownControl, err := serveAutosaveControl(daemon, stop)
+	if err != nil {
+		log.Warnf("autosave can't be controlled from other AtSS invocations: %s", err)
+	} else {
+		defer shutdownControl()
+	}
+	performBackup() // Perform a backup upon startup
+	<-ctx.Done()
+
+	log.Info("stopping, finishing pending backup if any")
+	daemon.finish()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTestSavesDirectory points the saves directory to a temporary directory
+// for the duration of the test.
+func useTestSavesDirectory(t *testing.T) string {
+	t.Helper()
+	prev := _savesDirectory
+	_savesDirectory = t.TempDir()
+	t.Cleanup(func() { _savesDirectory = prev })
+	return _savesDirectory
+}
+
+type testReporter struct {
+	reports []autoBackupReport
+}
+
+func (r *testReporter) report(report autoBackupReport) {
+	r.reports = append(r.reports, report)
+}
+
+func (r *testReporter) setGameStatus(string) {}
+
+func newTestDaemon(t *testing.T) *autoBackupDaemon {
+	t.Helper()
+	policy, err := newAutoBackupPolicy(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &autoBackupDaemon{
+		policy:          policy,
+		startedAt:       time.Now(),
+		reporter:        &testReporter{},
+		flushSaveUpdate: func() {},
+	}
+	d.queueSaveUpdate = d.handleSaveUpdate
+	return d
+}
+
+func countTestBackups(t *testing.T) int {
+	t.Helper()
+	dirs, err := filepath.Glob(filepath.Join(_backupsDirectory, "Bak.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(dirs)
+}
+
+func TestAutosaveSkipsRestoredSave(t *testing.T) {
+	useTestBackupsDirectory(t)
+	saves := useTestSavesDirectory(t)
+	started := time.Now()
+	exited := started.Add(time.Minute)
+
+	tests := []struct {
+		name   string
+		update func(d *autoBackupDaemon)
+	}{
+		{"save update", func(d *autoBackupDaemon) { d.handleSaveUpdate() }},
+		{"scheduled snapshot", func(d *autoBackupDaemon) {
+			d.session = &GameSession{StartedAt: started}
+			d.takeScheduledSnapshot()
+		}},
+		{"game exit", func(d *autoBackupDaemon) {
+			d.handleGameProcessEvent(gameProcessEvent{GameSession{StartedAt: started, EndedAt: &exited}})
+		}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTestSave(t, saves, true, 1, 0)
+			d := newTestDaemon(t)
+			d.handleSaveUpdate()
+			before := countTestBackups(t)
+
+			// Another instance restores a different state.
+			writeTestSave(t, saves, true, 2+i, 1)
+			restored := Backup{Dir: filepath.Join(_backupsDirectory, "Bak.restored")}
+			if err := writeRestoreMarker(restored); err != nil {
+				t.Fatal(err)
+			}
+			tt.update(d)
+			if n := countTestBackups(t); n != before {
+				t.Fatalf("backed up the restored save (%d backups, want %d)", n, before)
+			}
+			if d.parent != "Bak.restored" {
+				t.Errorf("parent = %q, want Bak.restored", d.parent)
+			}
+
+			// Progress after the restore is backed up, linked to the restored
+			// backup.
+			writeTestSave(t, saves, true, 2+i, 2)
+			d.handleSaveUpdate()
+			if n := countTestBackups(t); n != before+1 {
+				t.Fatalf("%d backups after progress, want %d", n, before+1)
+			}
+			if d.lastBackup == nil || d.lastBackup.Metadata.Parent != "Bak.restored" {
+				t.Errorf("last backup %+v not linked to the restored backup", d.lastBackup)
+			}
+			if d.restoredHash != "" {
+				t.Error("restored hash kept after the next backup")
+			}
+		})
+	}
+}
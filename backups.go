@@ -1,8 +1,9 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,6 +12,8 @@ import (
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/dustin/go-humanize"
+
 	"github.com/fanaticscripter/AtSS/log"
 )
 
@@ -21,6 +24,15 @@ const (
 	_backupDirnameFormat      = "Bak.2006-01-02_15.04.05"
 	_overwrittenBackupDirname = "Bak.overwritten"
 	_metadataFilename         = "atss.json"
+	_restoreMarkerFilename    = "atss-restore.json"
+	// Restore markers older than this are ignored.
+	_restoreMarkerMaxAge = 2 * time.Minute
+	// Attempts at finding a free backup dirname when backups are created in
+	// quick succession.
+	_backupDirnameAttempts = 10
+	// Save changes this long before the game is seen to exit are taken to be
+	// the save the game writes on exit.
+	_exitSaveGrace = 30 * time.Second
 )
 
 var _backupsDirectory string
@@ -29,18 +41,58 @@ var _errGameIsRunningRestoreRefused = fmt.Errorf(
 	"game is running, refusing to restore backup since the changes won't apply properly",
 )
 
+var _errBackupNotFound = errors.New("backup not found")
+
+var _errSaveChangedWhileWaiting = errors.New("current save changed while playing, after the restore was requested")
+
 type Backup struct {
 	Metadata BackupMetadata
 	Dir      string
+
+	// Number of transient errors retried while creating the backup; not
+	// persisted.
+	retries int
 }
 
 type BackupMetadata struct {
-	CreatedAt     time.Time `json:"createdAt"`
-	IsAutoSave    bool      `json:"isAutoSave"`
-	IsOverwritten bool      `json:"isOverwritten"` // Whether this is an automatic backup created on restore
-	Hash          string    `json:"hash"`
-	Note          string    `json:"note"`
-	Season        *SeasonId `json:"season"`
+	SchemaVersion int          `json:"schemaVersion"`
+	CreatedAt     time.Time    `json:"createdAt"`
+	IsAutoSave    bool         `json:"isAutoSave"`
+	IsOverwritten bool         `json:"isOverwritten"` // Whether this is an automatic backup created on restore
+	Origin        BackupOrigin `json:"origin"`
+	Hash          string       `json:"hash"`
+	Note          string       `json:"note"`
+	Season        *SeasonId    `json:"season"`
+	Files         []SaveFile   `json:"files"`             // Manifest of backed up save files; Hash above is the composite hash
+	Events        []SaveEvent  `json:"events,omitempty"`  // Events detected by autosave since the last backup
+	Session       *GameSession `json:"session,omitempty"` // Play session during which autosave created the backup
+	Parent        string       `json:"parent,omitempty"`  // Dirname of the backup restored before this autosave, if any
+	Pinned        bool         `json:"pinned,omitempty"`  // Marked as worth keeping by the user
+
+	// Fields not known to this version, preserved when writing back.
+	unknownFields map[string]json.RawMessage
+}
+
+// BackupOrigin tells what created a backup.
+type BackupOrigin string
+
+const (
+	_originManual    BackupOrigin = "manual"
+	_originAutosave  BackupOrigin = "autosave"
+	_originScheduled BackupOrigin = "scheduled" // Interval-based autosave snapshot
+	_originRestore   BackupOrigin = "restore"   // Backup of the state overwritten by a restore
+)
+
+// defaultBackupOrigin infers the origin from the older flags.
+func defaultBackupOrigin(isAutoSave, isOverwritten bool) BackupOrigin {
+	switch {
+	case isOverwritten:
+		return _originRestore
+	case isAutoSave:
+		return _originAutosave
+	default:
+		return _originManual
+	}
 }
 
 func (b Backup) String() string {
@@ -72,10 +124,17 @@ func (b Backup) String() string {
 	if b.Metadata.IsOverwritten {
 		s = "[overwritten] " + s
 	}
+	if b.Metadata.Pinned {
+		s = "[pinned] " + s
+	}
 	return s
 }
 
+// createBackup backs up the current save. The store lock is acquired for the
+// duration, except for overwritten backups, which are only created by restores
+// holding the lock already.
 func createBackup(metadata BackupMetadata) (backup Backup, err error) {
+	defer func() { audit(_auditCreate, backup, err) }()
 	pattern := filepath.Join(_savesDirectory, "*.save")
 	saveFiles, _ := filepath.Glob(pattern)
 	if len(saveFiles) == 0 {
@@ -96,9 +155,13 @@ func createBackup(metadata BackupMetadata) (backup Backup, err error) {
 		}
 	}
 
+	metadata.SchemaVersion = _metadataSchemaVersion
 	if metadata.CreatedAt.IsZero() {
 		metadata.CreatedAt = time.Now().Truncate(time.Second)
 	}
+	if metadata.Origin == "" {
+		metadata.Origin = defaultBackupOrigin(metadata.IsAutoSave, metadata.IsOverwritten)
+	}
 	if metadata.Season == nil {
 		saveData, readSaveErr := readSave(_savesDirectory)
 		if readSaveErr != nil {
@@ -107,45 +170,181 @@ func createBackup(metadata BackupMetadata) (backup Backup, err error) {
 		season := saveData.SeasonId()
 		metadata.Season = &season
 	}
+	var retries int
 	if metadata.Hash == "" {
 		var hashErr error
-		metadata.Hash, hashErr = hashSave(_savesDirectory)
+		retries, hashErr = _saveFileRetryPolicy.do("hashing save", func() (err error) {
+			metadata.Hash, err = hashSave(_savesDirectory)
+			return
+		})
 		if hashErr != nil {
 			log.Warnf("failed to hash save: %s", hashErr)
 		}
 	}
-	dirname := metadata.CreatedAt.Format(_backupDirnameFormat)
-	if metadata.IsOverwritten {
-		dirname = _overwrittenBackupDirname
-	}
 	backup = Backup{
 		Metadata: metadata,
-		Dir:      filepath.Join(_backupsDirectory, dirname),
+		Dir:      filepath.Join(_backupsDirectory, _overwrittenBackupDirname),
+		retries:  retries,
 	}
-
-	if metadata.IsOverwritten {
-		if err = os.RemoveAll(backup.Dir); err != nil {
-			err = fmt.Errorf("failed to remove existing overwritten backup directory '%s': %w", backup.Dir, err)
+	if !metadata.IsOverwritten {
+		// Reserve the directory up front, so that the pre hooks get the final
+		// one.
+		if backup.Dir, err = reserveBackupDir(metadata.CreatedAt); err != nil {
 			return
 		}
 	}
-	if err = os.Mkdir(backup.Dir, 0o755); err != nil {
-		err = fmt.Errorf("failed to create backup directory '%s': %w", backup.Dir, err)
-		return
+	log.Debugf("backing up %d save files to '%s' (origin %s, hash %s)", len(saveFiles), backup.Dir, metadata.Origin, metadata.Hash)
+	preHook, postHook := backupHooks(metadata)
+	if preHook != "" {
+		if err = runHooks(preHook, backup, nil); err != nil {
+			if !metadata.IsOverwritten {
+				_ = os.Remove(backup.Dir)
+			}
+			return
+		}
 	}
-	for _, f := range saveFiles {
-		if err = copyFile(f, filepath.Join(backup.Dir, filepath.Base(f))); err != nil {
-			err = fmt.Errorf("failed to copy save file '%s' to backup directory '%s': %w", f, backup.Dir, err)
+	if !metadata.IsOverwritten {
+		var unlock func()
+		if unlock, err = lockStore(); err != nil {
 			return
 		}
+		backup, err = writeBackup(backup, saveFiles)
+		unlock()
+	} else {
+		backup, err = writeBackup(backup, saveFiles)
+	}
+	if err == nil && postHook != "" {
+		_ = runHooks(postHook, backup, nil)
+	}
+	return
+}
+
+// reserveBackupDir creates the directory for a new backup created at the given
+// time. Dirnames have second precision, so if another backup was created within
+// the same second, e.g. by autosave racing a manual save, a numeric suffix is
+// appended to the dirname instead.
+func reserveBackupDir(createdAt time.Time) (dir string, err error) {
+	base := filepath.Join(_backupsDirectory, createdAt.Format(_backupDirnameFormat))
+	dir = base
+	for attempt := 1; ; attempt++ {
+		err = os.Mkdir(dir, 0o755)
+		if err == nil || !os.IsExist(err) || attempt == _backupDirnameAttempts {
+			break
+		}
+		dir = fmt.Sprintf("%s-%d", base, attempt+1)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to create backup directory '%s': %w", dir, err)
+	}
+	return
+}
+
+// parseBackupDirname parses the creation time from the name of a backup
+// directory, ignoring any suffix added by reserveBackupDir.
+func parseBackupDirname(dirname string) (time.Time, error) {
+	if len(dirname) > len(_backupDirnameFormat) && dirname[len(_backupDirnameFormat)] == '-' {
+		dirname = dirname[:len(_backupDirnameFormat)]
+	}
+	return time.Parse(_backupDirnameFormat, dirname)
+}
+
+// writeBackup copies the save files into the backup directory, and writes the
+// metadata. The directory of an overwritten backup is replaced; any other has
+// been reserved by reserveBackupDir.
+func writeBackup(backup Backup, saveFiles []string) (Backup, error) {
+	var err error
+	metadata := backup.Metadata
+	if metadata.IsOverwritten {
+		if _, statErr := os.Stat(backup.Dir); statErr == nil {
+			// Replacing the previous overwritten backup deletes it.
+			previous, _ := readBackup(backup.Dir)
+			err = os.RemoveAll(backup.Dir)
+			audit(_auditDelete, previous, err)
+		}
+		if err != nil {
+			return backup, fmt.Errorf("failed to remove existing overwritten backup directory '%s': %w", backup.Dir, err)
+		}
+		if err = os.Mkdir(backup.Dir, 0o755); err != nil {
+			return backup, fmt.Errorf("failed to create backup directory '%s': %w", backup.Dir, err)
+		}
 	}
+	for _, f := range saveFiles {
+		retries, err := _saveFileRetryPolicy.do(fmt.Sprintf("copying '%s'", filepath.Base(f)), func() error {
+			return copyFile(f, filepath.Join(backup.Dir, filepath.Base(f)))
+		})
+		backup.retries += retries
+		if err != nil {
+			return backup, fmt.Errorf("failed to copy save file '%s' to backup directory '%s': %w", f, backup.Dir, err)
+		}
+		log.Debugf("copied '%s' to '%s'", f, backup.Dir)
+	}
+	// The manifest describes the copies, which is what's restored later.
+	var manifestErr error
+	metadata.Files, manifestErr = buildSaveManifest(backup.Dir)
+	if manifestErr != nil {
+		log.Warnf("failed to build file manifest: %s", manifestErr)
+	}
+	backup.Metadata = metadata
 	if metadataErr := writeBackupMetadata(metadata, backup.Dir); metadataErr != nil {
 		log.Warnf("failed to write backup metadata: %s", metadataErr)
 	}
+	updateBackupIndex(func(index *backupIndex) { index.put(backup) })
+	return backup, nil
+}
+
+// updateBackupMetadata applies update to the metadata of an existing backup,
+// and updates the index accordingly. The metadata is re-read under the store
+// lock, so that concurrent changes to other fields aren't lost.
+func updateBackupMetadata(dir string, update func(metadata *BackupMetadata)) (backup Backup, err error) {
+	unlock, err := lockStore()
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if backup, err = readBackup(dir); err != nil {
+		return
+	}
+	update(&backup.Metadata)
+	if err = writeBackupMetadata(backup.Metadata, dir); err != nil {
+		return
+	}
+	updateBackupIndex(func(index *backupIndex) { index.put(backup) })
 	return
 }
 
+// annotateBackup replaces the note of an existing backup.
+func annotateBackup(backup Backup, note string) (Backup, error) {
+	return updateBackupMetadata(backup.Dir, func(metadata *BackupMetadata) { metadata.Note = note })
+}
+
+// pinBackup marks an existing backup as pinned or not.
+func pinBackup(backup Backup, pinned bool) (Backup, error) {
+	return updateBackupMetadata(backup.Dir, func(metadata *BackupMetadata) { metadata.Pinned = pinned })
+}
+
+func deleteBackup(backup Backup) (err error) {
+	defer func() { audit(_auditDelete, backup, err) }()
+	if err := runHooks(_hookPreDelete, backup, nil); err != nil {
+		return fmt.Errorf("refusing to delete backup '%s': %w", backup.Dir, err)
+	}
+	unlock, err := lockStore()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(backup.Dir); err != nil {
+		unlock()
+		return fmt.Errorf("failed to delete backup '%s': %w", backup.Dir, err)
+	}
+	updateBackupIndex(func(index *backupIndex) { index.remove(filepath.Base(backup.Dir)) })
+	unlock()
+	_ = runHooks(_hookPostDelete, backup, nil)
+	return nil
+}
+
 func writeBackupMetadata(metadata BackupMetadata, dir string) error {
+	if metadata.SchemaVersion > _metadataSchemaVersion {
+		return fmt.Errorf("refusing to overwrite metadata of backup '%s': %w", dir, _errMetadataFromNewerSchema)
+	}
 	encoded, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to encode backup metadata: %w", err)
@@ -159,14 +358,26 @@ func writeBackupMetadata(metadata BackupMetadata, dir string) error {
 
 func getBackups() (backups []Backup, err error) {
 	dirs, _ := filepath.Glob(filepath.Join(_backupsDirectory, "Bak.*"))
-	for _, dir := range dirs {
-		backup, err := readBackup(dir)
-		if err != nil {
-			log.Warn(err)
-			continue
+	index, indexErr := readBackupIndex()
+	if indexErr != nil {
+		if !os.IsNotExist(indexErr) {
+			log.Warnf("ignoring backup index: %s", indexErr)
 		}
-		backups = append(backups, backup)
+		index = backupIndex{}
+	}
+	if index.isUpToDate(dirs) {
+		log.Debugf("loaded %d backups from the index", len(index.Backups))
+	} else if unlock, ok := tryLockStore(); ok {
+		// Bring the index up to date, so that later listings don't load the
+		// same directories again. Only the index is written; backup metadata
+		// is left alone.
+		index = updateBackupIndex(func(*backupIndex) {})
+		unlock()
+	} else {
+		// Another operation holds the store lock, and updates the index.
+		index.refresh(dirs)
 	}
+	backups = index.backups()
 	slices.SortFunc(backups, func(b1, b2 Backup) int {
 		c := b2.Metadata.CreatedAt.Compare(b1.Metadata.CreatedAt)
 		if c != 0 {
@@ -177,12 +388,114 @@ func getBackups() (backups []Backup, err error) {
 	return
 }
 
+// findBackup looks up a backup by its directory name (e.g.
+// Bak.2006-01-02_15.04.05) or path.
+func findBackup(id string) (backup Backup, err error) {
+	backups, err := getBackups()
+	if err != nil {
+		return
+	}
+	dirname := filepath.Base(filepath.Clean(id))
+	for _, b := range backups {
+		if filepath.Base(b.Dir) == dirname {
+			return b, nil
+		}
+	}
+	err = fmt.Errorf("%w: '%s'", _errBackupNotFound, id)
+	return
+}
+
+// manifest returns the file manifest of the backup, computing it on the fly
+// if it isn't recorded in the metadata.
+func (b Backup) manifest() ([]SaveFile, error) {
+	if len(b.Metadata.Files) > 0 {
+		return b.Metadata.Files, nil
+	}
+	return buildSaveManifest(b.Dir)
+}
+
+// diffWithCurrentSave compares the files in the backup with the current save.
+func (b Backup) diffWithCurrentSave() (diffs []saveFileDiff, err error) {
+	backupFiles, err := b.manifest()
+	if err != nil {
+		return
+	}
+	currentFiles, err := buildSaveManifest(_savesDirectory)
+	if err != nil {
+		return
+	}
+	diffs = diffSaveManifests(backupFiles, currentFiles)
+	return
+}
+
+var _errBackupUnverifiable = errors.New("no file manifest recorded, run 'AtSS repair' to record one")
+
+// verifyBackup checks the files in a backup against the manifest recorded in
+// its metadata file, and returns a description of each problem found. A
+// manifest back-filled in memory from the files themselves is no baseline, so
+// a backup without a recorded one fails with _errBackupUnverifiable.
+func verifyBackup(backup Backup) (problems []string, err error) {
+	recorded, err := readRecordedManifest(backup.Dir)
+	if err != nil {
+		return
+	}
+	actual, err := buildSaveManifest(backup.Dir)
+	if err != nil {
+		return
+	}
+	for _, d := range diffSaveManifests(recorded, actual) {
+		switch d.Status {
+		case _saveFileModified:
+			problems = append(problems, fmt.Sprintf("%s: content does not match manifest (expected hash %s, got %s; size %s, got %s)",
+				d.Name, hashPrefix(d.Backup.Hash), hashPrefix(d.Current.Hash),
+				humanize.Bytes(uint64(d.Backup.Size)), humanize.Bytes(uint64(d.Current.Size))))
+		case _saveFileOnlyInBackup:
+			problems = append(problems, fmt.Sprintf("%s: missing", d.Name))
+		case _saveFileOnlyInCurrent:
+			problems = append(problems, fmt.Sprintf("%s: not in manifest", d.Name))
+		}
+	}
+	return
+}
+
+// hashPrefix shortens a file hash for display.
+func hashPrefix(hash string) string {
+	return hash[:min(12, len(hash))]
+}
+
+// readRecordedManifest reads the file manifest from the metadata file of the
+// backup as is, without migrations.
+func readRecordedManifest(dir string) ([]SaveFile, error) {
+	file := filepath.Join(dir, _metadataFilename)
+	encoded, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, _errBackupUnverifiable
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read backup metadata from '%s': %w", file, err)
+	}
+	var metadata struct {
+		Files []SaveFile `json:"files"`
+	}
+	if err := json.Unmarshal(encoded, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode backup metadata from '%s': %w", file, err)
+	}
+	if len(metadata.Files) == 0 {
+		return nil, _errBackupUnverifiable
+	}
+	return metadata.Files, nil
+}
+
+// readBackup loads a backup without modifying anything on disk. Outdated or
+// missing metadata is back-filled in memory only; see repairBackups.
 func readBackup(dir string) (backup Backup, err error) {
-	// Sometimes we introduce new metadata fields that are not present in old
-	// backups. We write them back when possible, as controlled by the
-	// metadataNeedsUpdate flag. However, we don't overwrite the metadata file
-	// if metadataLoadingFailed.
-	var metadataLoadingFailed, metadataNeedsUpdate bool
+	backup, _, err = inspectBackup(dir)
+	return
+}
+
+// inspectBackup loads a backup like readBackup, and additionally returns a
+// description of each repair needed to bring its metadata file up to date. The
+// repaired metadata is backup.Metadata.
+func inspectBackup(dir string) (backup Backup, repairs []string, err error) {
 	backup.Dir = dir
 	stat, err := os.Stat(dir)
 	if err != nil {
@@ -195,68 +508,195 @@ func readBackup(dir string) (backup Backup, err error) {
 		err = fmt.Errorf("failed to find .save files in backup directory '%s'", dir)
 		return
 	}
-	// Load metadata.
+	// Load metadata. Metadata that can't be written back (unreadable, from a
+	// newer schema, or failed to migrate) never gets repairs, but still gets
+	// the fallbacks below so that it lists properly.
+	writable := true
 	metadataFile := filepath.Join(dir, _metadataFilename)
 	encoded, readErr := os.ReadFile(metadataFile)
 	if readErr != nil {
-		metadataLoadingFailed = true
-		log.Warnf("failed to read backup metadata from '%s': %s", metadataFile, readErr)
-	} else {
-		if decodeErr := json.Unmarshal(encoded, &backup.Metadata); decodeErr != nil {
-			metadataLoadingFailed = true
-			log.Warnf("failed to decode backup metadata from '%s': %s", metadataFile, decodeErr)
+		if os.IsNotExist(readErr) {
+			log.Warnf("backup metadata '%s' does not exist", metadataFile)
+			repairs = append(repairs, "created missing metadata file")
+		} else {
+			log.Warnf("failed to read backup metadata from '%s': %s", metadataFile, readErr)
+			writable = false
 		}
+		encoded = []byte("{}")
 	}
+	var changes []string
+	backup.Metadata, changes, err = decodeBackupMetadata(encoded, dir)
+	if err != nil {
+		log.Warnf("failed to decode backup metadata from '%s': %s", metadataFile, err)
+		if errors.Is(err, _errMetadataFromNewerSchema) || errors.Is(err, _errMetadataMigrationFailed) {
+			writable = false
+		} else {
+			repairs = append(repairs, fmt.Sprintf("replaced undecodable metadata (%s)", err))
+			backup.Metadata, changes, _ = decodeBackupMetadata([]byte("{}"), dir)
+		}
+		err = nil
+	}
+	repairs = append(repairs, changes...)
 	// Fallback to parsing backup directory name.
 	if backup.Metadata.CreatedAt.IsZero() {
 		dirname := filepath.Base(dir)
 		if dirname == _overwrittenBackupDirname {
-			backup.Metadata.IsOverwritten = true
+			if !backup.Metadata.IsOverwritten {
+				backup.Metadata.IsOverwritten = true
+				backup.Metadata.Origin = _originRestore
+				repairs = append(repairs, "marked as overwritten backup")
+			}
 		} else {
 			var timeParseErr error
-			backup.Metadata.CreatedAt, timeParseErr = time.Parse(_backupDirnameFormat, dirname)
+			backup.Metadata.CreatedAt, timeParseErr = parseBackupDirname(dirname)
 			if timeParseErr != nil {
 				log.Warnf("unrecognized backup directory name '%s'", dirname)
+			} else {
+				repairs = append(repairs, "set creation time from directory name")
 			}
 		}
 	}
 	// Fallback to using the directory's modification time.
 	if backup.Metadata.CreatedAt.IsZero() {
 		backup.Metadata.CreatedAt = stat.ModTime()
+		repairs = append(repairs, "set creation time from directory modification time")
 	}
-	if backup.Metadata.Hash == "" {
-		var hashErr error
-		backup.Metadata.Hash, hashErr = hashSave(dir)
-		if hashErr != nil {
-			log.Warnf("failed to hash backup '%s': %s", dir, hashErr)
-		} else {
-			metadataNeedsUpdate = true
-		}
+	if !writable {
+		repairs = nil
 	}
-	if backup.Metadata.Season == nil {
-		saveData, readSaveErr := readSave(dir)
-		if readSaveErr != nil {
-			log.Warn(readSaveErr)
-		} else {
-			season := saveData.SeasonId()
-			backup.Metadata.Season = &season
-			metadataNeedsUpdate = true
-		}
+	return
+}
+
+// restoreScope determines what is restored from a backup.
+type restoreScope struct {
+	// Restore only these save files (base names); all save files if empty.
+	Files []string `json:"files,omitempty"`
+	// Restore the settlement state, keeping the current meta-progression; see
+	// _settlementOnlyMergeSpecs.
+	SettlementOnly bool `json:"settlementOnly"`
+}
+
+// restoreBackup restores the backup within the given scope. An auto backup of
+// the entire current save is created before overwriting either way. The
+// restore is refused if a pre-restore hook fails.
+func restoreBackup(backup Backup, scope restoreScope) (autoBackup Backup, err error) {
+	defer func() { audit(_auditRestore, backup, err) }()
+	log.Debugf("restoring backup '%s' (files %v, settlement only %t)", backup.Dir, scope.Files, scope.SettlementOnly)
+	if err = runHooks(_hookPreRestore, backup, &scope); err != nil {
+		err = fmt.Errorf("refusing to restore backup '%s': %w", backup.Dir, err)
+		return
 	}
-	if !metadataLoadingFailed && metadataNeedsUpdate {
-		encoded, encodeErr := json.MarshalIndent(backup.Metadata, "", "  ")
-		if encodeErr != nil {
-			log.Warnf("failed to encode metadata of backup '%s': %s", dir, encodeErr)
-		} else {
-			if writeErr := os.WriteFile(metadataFile, encoded, 0o644); writeErr != nil {
-				log.Warnf("failed to write back metadata of backup '%s': %s", dir, writeErr)
-			}
+	unlock, err := lockStore()
+	if err != nil {
+		return
+	}
+	if scope.SettlementOnly {
+		autoBackup, err = restoreSettlementOnly(backup)
+	} else {
+		autoBackup, err = restoreSaveFiles(backup, scope.Files)
+	}
+	if err == nil {
+		if markerErr := writeRestoreMarker(backup); markerErr != nil {
+			log.Warn(markerErr)
 		}
 	}
+	unlock()
+	if err == nil {
+		_ = runHooks(_hookPostRestore, backup, &scope)
+	}
 	return
 }
 
-func restoreBackup(backup Backup) (autoBackup Backup, err error) {
+// restoreMarker is left in the backups root directory by a restore, so that a
+// running autosave recognizes the resulting save update as its own doing
+// rather than progress worth backing up.
+type restoreMarker struct {
+	Backup     string    `json:"backup"` // Dirname of the restored backup
+	Hash       string    `json:"hash"`   // Hash of the save right after the restore
+	RestoredAt time.Time `json:"restoredAt"`
+}
+
+func writeRestoreMarker(backup Backup) error {
+	hash, err := hashSave(_savesDirectory)
+	if err != nil {
+		return fmt.Errorf("failed to hash restored save: %w", err)
+	}
+	encoded, _ := json.Marshal(restoreMarker{
+		Backup:     filepath.Base(backup.Dir),
+		Hash:       hash,
+		RestoredAt: time.Now(),
+	})
+	file := filepath.Join(_backupsDirectory, _restoreMarkerFilename)
+	if err := writeFileAtomic(file, encoded, 0o644); err != nil {
+		return fmt.Errorf("failed to write restore marker '%s': %w", file, err)
+	}
+	return nil
+}
+
+// takeRestoreMarker consumes the restore marker, if there is a recent one.
+func takeRestoreMarker() (marker restoreMarker, ok bool) {
+	file := filepath.Join(_backupsDirectory, _restoreMarkerFilename)
+	encoded, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if err := os.Remove(file); err != nil {
+		log.Warnf("failed to remove restore marker '%s': %s", file, err)
+	}
+	if err := json.Unmarshal(encoded, &marker); err != nil {
+		log.Warnf("failed to decode restore marker '%s': %s", file, err)
+		return
+	}
+	// Stale markers, e.g. from restores while autosave wasn't running, are
+	// discarded.
+	return marker, time.Since(marker.RestoredAt) < _restoreMarkerMaxAge
+}
+
+// exitSaveWatch tells changes to the current save made while playing from the
+// save the game writes on exit. A restore waiting for the game to exit may
+// replace the latter, which is backed up as the overwritten backup anyway.
+type exitSaveWatch struct {
+	before    []SaveFile
+	changedAt time.Time
+}
+
+func newExitSaveWatch() *exitSaveWatch {
+	return &exitSaveWatch{before: statSaveFiles(_savesDirectory)}
+}
+
+// poll notes the first change to the save; it's called while the game is
+// running.
+func (w *exitSaveWatch) poll() {
+	if w.changedAt.IsZero() && !slices.Equal(statSaveFiles(_savesDirectory), w.before) {
+		w.changedAt = time.Now()
+	}
+}
+
+// changedWhilePlaying reports whether the save changed while the game was
+// running, other than within _exitSaveGrace before it exited.
+func (w *exitSaveWatch) changedWhilePlaying() bool {
+	return !w.changedAt.IsZero() && time.Since(w.changedAt) > _exitSaveGrace
+}
+
+// restoreBackupAfterGameExit waits for the game to exit, then restores the
+// backup, provided that watch, created when the restore was requested, saw no
+// changes to the save while playing. Otherwise, confirmChanged is consulted,
+// and the restore is refused with _errSaveChangedWhileWaiting if it returns
+// false.
+func restoreBackupAfterGameExit(ctx context.Context, backup Backup, scope restoreScope, watch *exitSaveWatch, confirmChanged func() bool) (autoBackup Backup, err error) {
+	if err = waitForGameExit(ctx, watch.poll); err != nil {
+		return
+	}
+	if watch.changedWhilePlaying() && !confirmChanged() {
+		err = _errSaveChangedWhileWaiting
+		return
+	}
+	return restoreBackup(backup, scope)
+}
+
+// restoreSaveFiles restores the given save files from the backup, or all save
+// files if files is empty.
+func restoreSaveFiles(backup Backup, files []string) (autoBackup Backup, err error) {
 	log.Infof("restoring backup '%s'", backup.Dir)
 
 	pattern := filepath.Join(backup.Dir, "*.save")
@@ -265,32 +705,51 @@ func restoreBackup(backup Backup) (autoBackup Backup, err error) {
 		err = fmt.Errorf("failed to find save files '%s'", pattern)
 		return
 	}
-	for _, expected := range _expectedSaveFiles {
-		found := false
-		for _, f := range saveFiles {
-			if filepath.Base(f) == expected {
-				found = true
-				break
+	if len(files) > 0 {
+		var selected []string
+		for _, name := range files {
+			f := filepath.Join(backup.Dir, name)
+			if !slices.Contains(saveFiles, f) {
+				err = fmt.Errorf("save file '%s' not found in backup directory '%s'", name, backup.Dir)
+				return
 			}
+			selected = append(selected, f)
 		}
-		if !found {
-			log.Warnf("expected save file '%s' not found in backup directory '%s'", expected, backup.Dir)
+		saveFiles = selected
+		log.Infof("restoring only %s", strings.Join(files, ", "))
+	} else {
+		for _, expected := range _expectedSaveFiles {
+			found := false
+			for _, f := range saveFiles {
+				if filepath.Base(f) == expected {
+					found = true
+					break
+				}
+			}
+			if !found {
+				log.Warnf("expected save file '%s' not found in backup directory '%s'", expected, backup.Dir)
+			}
 		}
 	}
 
-	// Compare WorldSave.save to determine if game restart is required.
-	var currentWorldSaveContent, backupWorldSaveContent []byte
-	currentWorldSave := filepath.Join(_savesDirectory, "WorldSave.save")
-	backupWorldSave := filepath.Join(backup.Dir, "WorldSave.save")
-	currentWorldSaveContent, err = os.ReadFile(currentWorldSave)
-	if err != nil {
-		log.Warnf("failed to read %s: %s", currentWorldSave, err)
-	}
-	backupWorldSaveContent, err = os.ReadFile(backupWorldSave)
-	if err != nil {
-		log.Warnf("failed to read %s: %s", backupWorldSave, err)
+	// Compare files against the current save, in particular WorldSave.save to
+	// determine if game restart is required.
+	diffs, diffErr := backup.diffWithCurrentSave()
+	if diffErr != nil {
+		log.Warnf("failed to compare backup with current save: %s", diffErr)
+	}
+	gameRestartRequied := diffErr != nil
+	for _, d := range diffs {
+		log.Info(d)
+	}
+	for _, c := range selectiveRestoreConsequences(diffs, files) {
+		if c.restartRequired {
+			gameRestartRequied = true
+		}
+		if len(files) > 0 {
+			log.Warn(c.description)
+		}
 	}
-	gameRestartRequied := !bytes.Equal(currentWorldSaveContent, backupWorldSaveContent)
 
 	// Refuse restore if game restart is required but game is running.
 	if gameRestartRequied {
@@ -305,6 +764,69 @@ func restoreBackup(backup Backup) (autoBackup Backup, err error) {
 		}
 	}
 
+	if autoBackup, err = overwriteSaveFiles(saveFiles); err != nil {
+		return
+	}
+
+	log.Infof("restored backup '%s'", backup.Dir)
+	return
+}
+
+// restoreSettlementOnly restores the settlement state from the backup, merged
+// with the current meta-progression.
+func restoreSettlementOnly(backup Backup) (autoBackup Backup, err error) {
+	log.Infof("restoring settlement from backup '%s', keeping current meta-progression", backup.Dir)
+
+	mergeDir, err := os.MkdirTemp("", "atss-merge-")
+	if err != nil {
+		err = fmt.Errorf("failed to create temporary directory: %w", err)
+		return
+	}
+	defer os.RemoveAll(mergeDir)
+	previews, err := mergeSettlementOnly(backup, mergeDir)
+	if err != nil {
+		return
+	}
+	for _, p := range previews {
+		log.Info(p)
+	}
+	var saveFiles, files []string
+	for _, spec := range _settlementOnlyMergeSpecs {
+		saveFiles = append(saveFiles, filepath.Join(mergeDir, spec.File))
+		files = append(files, spec.File)
+	}
+	diffs, diffErr := backup.diffWithCurrentSave()
+	if diffErr != nil {
+		log.Warnf("failed to compare backup with current save: %s", diffErr)
+	}
+	for _, c := range selectiveRestoreConsequences(diffs, files) {
+		log.Warn(c.description)
+	}
+
+	if autoBackup, err = overwriteSaveFiles(saveFiles); err != nil {
+		return
+	}
+
+	log.Infof("restored settlement from backup '%s'", backup.Dir)
+	return
+}
+
+// mergeSettlementOnly writes the save files for a settlement-only restore of
+// the backup to outDir, and validates the result.
+func mergeSettlementOnly(backup Backup, outDir string) (previews []mergePreview, err error) {
+	previews, err = mergeSaveFiles(_settlementOnlyMergeSpecs, backup.Dir, _savesDirectory, outDir)
+	if err != nil {
+		return
+	}
+	if _, err = readSave(outDir); err != nil {
+		err = fmt.Errorf("merged save failed validation, refusing to restore: %w", err)
+	}
+	return
+}
+
+// overwriteSaveFiles copies the given files into the saves directory, after
+// creating an auto backup of the current state.
+func overwriteSaveFiles(saveFiles []string) (autoBackup Backup, err error) {
 	// Create auto backup of current state.
 	log.Info("creating auto backup of current state before overwriting")
 	autoBackup, err = createBackup(BackupMetadata{
@@ -324,7 +846,54 @@ func restoreBackup(backup Backup) (autoBackup Backup, err error) {
 			return
 		}
 	}
+	return
+}
 
-	log.Infof("restored backup '%s'", backup.Dir)
+type restoreConsequence struct {
+	description     string
+	restartRequired bool
+}
+
+// selectiveRestoreConsequences explains the consequences of restoring only
+// the given files (all files if empty), given the differences between the
+// backup and the current save.
+func selectiveRestoreConsequences(diffs []saveFileDiff, files []string) (consequences []restoreConsequence) {
+	restored := func(name string) bool {
+		return len(files) == 0 || slices.Contains(files, name)
+	}
+	differs := make(map[string]bool)
+	for _, d := range diffs {
+		if d.Status != _saveFileIdentical && d.Status != _saveFileOnlyInCurrent {
+			differs[d.Name] = true
+		}
+	}
+	if differs["WorldSave.save"] {
+		if restored("WorldSave.save") {
+			consequences = append(consequences, restoreConsequence{
+				description:     "WorldSave.save differs from the current save, so the game needs to be restarted for the restore to take effect.",
+				restartRequired: true,
+			})
+		} else {
+			consequences = append(consequences, restoreConsequence{
+				description: "WorldSave.save differs from the current save but is not restored; the current world map is kept, which may not match the restored files.",
+			})
+		}
+	}
+	if restored("Save.save") != restored("MetaSave.save") && (differs["Save.save"] || differs["MetaSave.save"]) {
+		consequences = append(consequences, restoreConsequence{
+			description: "Only one of Save.save and MetaSave.save is restored; MetaSave.save records whether there's an active settlement, so the settlement may be missing or inconsistent in game.",
+		})
+	}
+	var unchanged []string
+	for _, name := range files {
+		if !differs[name] {
+			unchanged = append(unchanged, name)
+		}
+	}
+	if len(unchanged) > 0 {
+		consequences = append(consequences, restoreConsequence{
+			description: fmt.Sprintf("Identical to the current save, restoring has no effect: %s.", strings.Join(unchanged, ", ")),
+		})
+	}
 	return
 }
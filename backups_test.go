@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyBackup(t *testing.T) {
+	useTestBackupsDirectory(t)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		noManifest   bool
+		change       func(dir string)
+		wantProblems []string
+		wantErr      error
+	}{
+		{"intact", false, func(string) {}, nil, nil},
+		{"modified", false, func(dir string) {
+			writeTestFile(t, filepath.Join(dir, "Save.save"), `{"gameplay":{"year":9,"season":2}}`)
+		}, []string{"Save.save: content does not match manifest (expected hash "}, nil},
+		{"missing", false, func(dir string) {
+			if err := os.Remove(filepath.Join(dir, "MetaSave.save")); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{"MetaSave.save: missing"}, nil},
+		{"extra file", false, func(dir string) {
+			writeTestFile(t, filepath.Join(dir, "WorldSave.save"), `{}`)
+		}, []string{"WorldSave.save: not in manifest"}, nil},
+		{"no manifest", true, func(string) {}, nil, _errBackupUnverifiable},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := BackupMetadata{CreatedAt: created.Add(time.Duration(i) * time.Second)}
+			backup := writeTestBackup(t, "Bak."+strings.ReplaceAll(tt.name, " ", "-"), metadata)
+			if !tt.noManifest {
+				files, err := buildSaveManifest(backup.Dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				backup.Metadata.Files = files
+				if err := writeBackupMetadata(backup.Metadata, backup.Dir); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.change(backup.Dir)
+
+			problems, err := verifyBackup(backup)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verifyBackup error = %v, want %v", err, tt.wantErr)
+			}
+			if len(problems) != len(tt.wantProblems) {
+				t.Fatalf("problems = %q, want %q", problems, tt.wantProblems)
+			}
+			for i, want := range tt.wantProblems {
+				if !strings.HasPrefix(problems[i], want) {
+					t.Errorf("problem = %q, want prefix %q", problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateBackupDirnameCollision(t *testing.T) {
+	useTestBackupsDirectory(t)
+	writeTestSave(t, useTestSavesDirectory(t), true, 1, 0)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for i, wantDirname := range []string{"Bak.2024-01-02_03.04.05", "Bak.2024-01-02_03.04.05-2", "Bak.2024-01-02_03.04.05-3"} {
+		backup, err := createBackup(BackupMetadata{CreatedAt: created, Note: fmt.Sprint(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dirname := filepath.Base(backup.Dir); dirname != wantDirname {
+			t.Errorf("dirname = %q, want %q", dirname, wantDirname)
+		}
+		if !backup.Metadata.CreatedAt.Equal(created) {
+			t.Errorf("%s: created at %s, want %s", wantDirname, backup.Metadata.CreatedAt, created)
+		}
+		parsed, err := parseBackupDirname(wantDirname)
+		if err != nil || !parsed.Equal(created) {
+			t.Errorf("parseBackupDirname(%q) = %s, %v, want %s", wantDirname, parsed, err, created)
+		}
+	}
+}
+
+func TestExitSaveWatch(t *testing.T) {
+	saves := useTestSavesDirectory(t)
+	writeTestSave(t, saves, true, 1, 0)
+
+	tests := []struct {
+		name        string
+		change      bool
+		changedAgo  time.Duration
+		wantChanged bool
+	}{
+		{"unchanged", false, 0, false},
+		{"saved on exit", true, time.Second, false},
+		{"saved while playing", true, time.Minute, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watch := newExitSaveWatch()
+			watch.poll()
+			if tt.change {
+				writeTestFile(t, filepath.Join(saves, "Save.save"), fmt.Sprintf(`{"gameplay":{"year":%d,"season":1}}`, 10+i))
+			}
+			watch.poll()
+			if watch.changedAt.IsZero() == tt.change {
+				t.Fatalf("change noted at %s, want noted %t", watch.changedAt, tt.change)
+			}
+			if tt.change {
+				watch.changedAt = time.Now().Add(-tt.changedAgo)
+			}
+			if got := watch.changedWhilePlaying(); got != tt.wantChanged {
+				t.Errorf("changedWhilePlaying = %t, want %t", got, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestSelectiveRestoreConsequences(t *testing.T) {
+	diffs := func(differing ...string) (diffs []saveFileDiff) {
+		for _, name := range []string{"MetaSave.save", "Save.save", "WorldSave.save"} {
+			status := _saveFileIdentical
+			if slices.Contains(differing, name) {
+				status = _saveFileModified
+			}
+			diffs = append(diffs, saveFileDiff{Name: name, Status: status})
+		}
+		return
+	}
+
+	tests := []struct {
+		name        string
+		diffs       []saveFileDiff
+		files       []string
+		wantPrefix  []string
+		wantRestart bool
+	}{
+		{"all files, world unchanged", diffs("Save.save", "MetaSave.save"), nil, nil, false},
+		{"all files, world changed", diffs("Save.save", "WorldSave.save"), nil,
+			[]string{"WorldSave.save differs from the current save, so the game needs to be restarted"}, true},
+		{"world changed but not restored", diffs("Save.save", "MetaSave.save", "WorldSave.save"), []string{"Save.save", "MetaSave.save"},
+			[]string{"WorldSave.save differs from the current save but is not restored"}, false},
+		{"only Save.save", diffs("Save.save"), []string{"Save.save"},
+			[]string{"Only one of Save.save and MetaSave.save is restored"}, false},
+		{"only MetaSave.save, both identical", diffs(), []string{"MetaSave.save"},
+			[]string{"Identical to the current save, restoring has no effect: MetaSave.save."}, false},
+		{"new file in current save", append(diffs(), saveFileDiff{Name: "Extra.save", Status: _saveFileOnlyInCurrent}), nil, nil, false},
+		{"file only in backup", []saveFileDiff{
+			{Name: "MetaSave.save", Status: _saveFileIdentical},
+			{Name: "Save.save", Status: _saveFileIdentical},
+			{Name: "WorldSave.save", Status: _saveFileOnlyInBackup},
+		}, nil,
+			[]string{"WorldSave.save differs from the current save, so the game needs to be restarted"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consequences := selectiveRestoreConsequences(tt.diffs, tt.files)
+			if len(consequences) != len(tt.wantPrefix) {
+				t.Fatalf("consequences = %+v, want %q", consequences, tt.wantPrefix)
+			}
+			restart := false
+			for i, c := range consequences {
+				if !strings.HasPrefix(c.description, tt.wantPrefix[i]) {
+					t.Errorf("consequence = %q, want prefix %q", c.description, tt.wantPrefix[i])
+				}
+				restart = restart || c.restartRequired
+			}
+			if restart != tt.wantRestart {
+				t.Errorf("restart required = %t, want %t", restart, tt.wantRestart)
+			}
+		})
+	}
+}
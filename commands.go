@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/dustin/go-humanize"
@@ -52,14 +57,18 @@ func createBackupInteractive() error {
 	return nil
 }
 
-func restoreBackupInteractive() error {
+// restoreBackupInteractive lets the user choose a backup to restore. If scope
+// is non-zero, it is used for the restore; otherwise the user is asked what to
+// restore.
+func restoreBackupInteractive(scope restoreScope) error {
 	backups, err := getBackups()
 	if err != nil {
 		return err
 	}
-	var options []huh.Option[Backup]
+	var options []huh.Option[*Backup]
 	var hasOverwritten bool
-	for _, b := range backups {
+	for i := range backups {
+		b := &backups[i]
 		text := b.String()
 		if b.Metadata.IsAutoSave {
 			// Dim auto backups.
@@ -75,7 +84,8 @@ func restoreBackupInteractive() error {
 		"You don't need to exit the game if you're going back to an earlier point of the same settlement, " +
 		"but you do need to exit the game first if you're going back to the map to reroll a biome, or going back to an earlier state of the map.")
 
-	var backup Backup
+	var backup *Backup
+	var selectedScope restoreScope
 	for {
 		var description string
 		if hasOverwritten {
@@ -83,7 +93,7 @@ func restoreBackupInteractive() error {
 		}
 		form := huh.NewForm(
 			huh.NewGroup(
-				huh.NewSelect[Backup]().
+				huh.NewSelect[*Backup]().
 					Title("Choose a backup to restore").
 					Description(description).
 					Options(options...).
@@ -93,15 +103,27 @@ func restoreBackupInteractive() error {
 		if err := form.Run(); err != nil {
 			return fmt.Errorf("failed to get user selection: %w", err)
 		}
+		selectedScope = scope
+		if len(selectedScope.Files) == 0 && !selectedScope.SettlementOnly {
+			if selectedScope, err = chooseRestoreScopeInteractive(*backup); err != nil {
+				return err
+			}
+		}
 		// Confirm.
 		//
 		// huh doesn't seem to support defaulting to yes, so we have to reverse
 		// the yes/no as a workaround.
+		title := fmt.Sprintf("Restore backup '%s'?", backup)
+		if selectedScope.SettlementOnly {
+			title = fmt.Sprintf("Restore settlement from backup '%s'?", backup)
+		} else if len(selectedScope.Files) > 0 {
+			title = fmt.Sprintf("Restore %s from backup '%s'?", strings.Join(selectedScope.Files, ", "), backup)
+		}
 		var chooseAgain bool
 		form = huh.NewForm(
 			huh.NewGroup(
 				huh.NewConfirm().
-					Title(fmt.Sprintf("Restore backup '%s'?", backup)).
+					Title(title).
 					Affirmative("No").
 					Negative("Yes").
 					Value(&chooseAgain),
@@ -115,24 +137,254 @@ func restoreBackupInteractive() error {
 		}
 	}
 
-	_, err = restoreBackup(backup)
+	watch := newExitSaveWatch()
+	_, err = restoreBackup(*backup, selectedScope)
 	if errors.Is(err, _errGameIsRunningRestoreRefused) {
 		displayWarning("You need to quit the game before performing this restore, or the changes won't take full effect.\n\n" +
-			"Please quit the game (quitting to main menu isn't enough) and try the restore again.")
+			"Please quit the game (quitting to main menu isn't enough), and the restore can be performed once the game exits.")
+		return deferRestoreInteractive(*backup, selectedScope, watch)
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// deferRestoreInteractive offers to wait for the game to exit and perform the
+// restore then.
+func deferRestoreInteractive(backup Backup, scope restoreScope, watch *exitSaveWatch) error {
+	var wait bool
+	form := huh.NewForm(
+		huh.NewGroup(huh.NewConfirm().Title("Restore when the game exits?").Value(&wait)),
+	)
+	if err := form.Run(); err != nil {
+		return fmt.Errorf("failed to get user confirmation: %w", err)
+	}
+	if !wait {
+		return _errGameIsRunningRestoreRefused
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, err := tea.NewProgram(newWaitForGameExitTeaModel(ctx, cancel, watch)).Run()
+	if err != nil {
+		return err
+	}
+	if err := m.(waitForGameExitTeaModel).err; err != nil {
+		if errors.Is(err, context.Canceled) {
+			return fmt.Errorf("restore canceled")
+		}
+		return err
+	}
+
+	_, err = restoreBackupAfterGameExit(ctx, backup, scope, watch, func() bool {
+		displayWarning("Your current game save changed while you kept playing after requesting the restore. " +
+			"It will be kept in the [overwritten] backup if you proceed.")
+		var proceed bool
+		form := huh.NewForm(
+			huh.NewGroup(huh.NewConfirm().Title("Restore anyway?").Value(&proceed)),
+		)
+		if err := form.Run(); err != nil {
+			return false
+		}
+		return proceed
+	})
+	return err
+}
+
+type gameExitedMsg struct {
+	err error
+}
+
+// waitForGameExitTeaModel shows a spinner while waiting for the game to exit,
+// which can be canceled.
+type waitForGameExitTeaModel struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	watch   *exitSaveWatch
+	spinner spinner.Model
+	err     error
+	done    bool
+}
+
+func newWaitForGameExitTeaModel(ctx context.Context, cancel context.CancelFunc, watch *exitSaveWatch) waitForGameExitTeaModel {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	return waitForGameExitTeaModel{ctx: ctx, cancel: cancel, watch: watch, spinner: s}
+}
+
+func (m waitForGameExitTeaModel) Init() tea.Cmd {
+	return tea.Batch(func() tea.Msg {
+		return gameExitedMsg{waitForGameExit(m.ctx, m.watch.poll)}
+	}, m.spinner.Tick)
+}
+
+func (m waitForGameExitTeaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "esc", "q":
+			m.cancel()
+			return m, nil
+		default:
+			return m, nil
+		}
+
+	case gameExitedMsg:
+		m.err = msg.err
+		m.done = true
+		return m, tea.Quit
+
+	default:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+}
+
+func (m waitForGameExitTeaModel) View() string {
+	if m.done {
+		if m.err != nil {
+			return "Stopped waiting for the game to exit.\n"
+		}
+		return "The game has exited.\n"
+	}
+	return fmt.Sprintf("%s Waiting for the game to exit... (esc to cancel)\n", m.spinner.View())
+}
+
+// chooseRestoreScopeInteractive asks the user whether to restore all save
+// files in the backup, only some of them, or only the settlement. The
+// consequences of a partial restore are explained before returning.
+func chooseRestoreScopeInteractive(backup Backup) (scope restoreScope, err error) {
+	var choice string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("What to restore?").
+				Options(
+					huh.NewOption("All save files", "all"),
+					huh.NewOption("Only some save files", "files"),
+					huh.NewOption("Settlement only, keeping current meta-progression", "settlement"),
+				).
+				Value(&choice),
+		),
+	)
+	if err = form.Run(); err != nil {
+		err = fmt.Errorf("failed to get user selection: %w", err)
+		return
+	}
+	switch choice {
+	case "files":
+		scope.Files, err = chooseFilesToRestoreInteractive(backup)
+	case "settlement":
+		scope.SettlementOnly = true
+		err = previewSettlementOnlyRestore(backup)
+	}
+	return
+}
+
+func previewSettlementOnlyRestore(backup Backup) error {
+	mergeDir, err := os.MkdirTemp("", "atss-merge-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
 	}
+	defer os.RemoveAll(mergeDir)
+	previews, err := mergeSettlementOnly(backup, mergeDir)
 	if err != nil {
 		return err
 	}
+	var lines []string
+	for _, spec := range _settlementOnlyMergeSpecs {
+		if len(spec.Rules) == 0 {
+			lines = append(lines, fmt.Sprintf("%s from %s", spec.File, spec.Base))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s from %s, except:", spec.File, spec.Base))
+		}
+		for _, p := range previews {
+			if p.File == spec.File {
+				lines = append(lines, fmt.Sprintf("  %s from %s: %s (current %s, backup %s)",
+					p.Rule.Path, p.Rule.From, p.Merged, p.Current, p.Backup))
+			}
+		}
+	}
+	lines = append(lines, "Other save files are kept as is.")
+	displayNotice(strings.Join(lines, "\n"))
 	return nil
 }
 
+// chooseFilesToRestoreInteractive lets the user choose save files to restore,
+// and explains the consequences.
+func chooseFilesToRestoreInteractive(backup Backup) (files []string, err error) {
+	diffs, err := backup.diffWithCurrentSave()
+	if err != nil {
+		return
+	}
+	var options []huh.Option[string]
+	for _, d := range diffs {
+		if d.Status == _saveFileOnlyInCurrent {
+			continue
+		}
+		options = append(options, huh.NewOption(d.String(), d.Name))
+	}
+	selectGroup := huh.NewGroup(
+		huh.NewMultiSelect[string]().
+			Title("Choose save files to restore").
+			Options(options...).
+			Value(&files).
+			Validate(func(s []string) error {
+				if len(s) == 0 {
+					return fmt.Errorf("nothing is selected")
+				}
+				return nil
+			}),
+	)
+	if err = huh.NewForm(selectGroup).Run(); err != nil {
+		err = fmt.Errorf("failed to get user selection: %w", err)
+		return
+	}
+	// Keep the selection displayed.
+	fmt.Println(selectGroup.WithShowHelp(false).View())
+
+	var notes []string
+	for _, c := range selectiveRestoreConsequences(diffs, files) {
+		notes = append(notes, c.description)
+	}
+	if len(notes) > 0 {
+		displayWarning(strings.Join(notes, "\n\n"))
+	}
+	return
+}
+
+// deleteBackups deletes the backups with the given IDs, after making sure all
+// of them exist.
+func deleteBackups(ids []string) (deleted []Backup, err error) {
+	var backups []Backup
+	for _, id := range ids {
+		b, err := findBackup(id)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, b)
+	}
+	for _, b := range backups {
+		if err := deleteBackup(b); err != nil {
+			return deleted, err
+		}
+		log.Infof("deleted backup %s", b.Dir)
+		deleted = append(deleted, b)
+	}
+	return deleted, nil
+}
+
 func deleteBackupsInteractive() error {
 	backups, err := getBackups()
 	if err != nil {
 		return err
 	}
-	var options []huh.Option[Backup]
-	for _, b := range backups {
+	var options []huh.Option[*Backup]
+	for i := range backups {
+		b := &backups[i]
 		if b.Metadata.IsOverwritten {
 			// There's only one copy of this auto overwritten backup, no point deleting it.
 			continue
@@ -144,14 +396,14 @@ func deleteBackupsInteractive() error {
 		}
 		options = append(options, huh.NewOption(text, b))
 	}
-	var toDelete []Backup
+	var toDelete []*Backup
 	for {
 		selectGroup := huh.NewGroup(
-			huh.NewMultiSelect[Backup]().
+			huh.NewMultiSelect[*Backup]().
 				Title("Choose backups to delete").
 				Options(options...).
 				Value(&toDelete).
-				Validate(func(s []Backup) error {
+				Validate(func(s []*Backup) error {
 					if len(s) == 0 {
 						return fmt.Errorf("nothing is selected")
 					}
@@ -178,8 +430,8 @@ func deleteBackupsInteractive() error {
 		}
 	}
 	for _, b := range toDelete {
-		if err := os.RemoveAll(b.Dir); err != nil {
-			log.Errorf("failed to delete backup '%s': %s", b.Dir, err)
+		if err := deleteBackup(*b); err != nil {
+			log.Error(err)
 		} else {
 			log.Infof("deleted backup '%s'", b.Dir)
 		}
@@ -187,6 +439,120 @@ func deleteBackupsInteractive() error {
 	return nil
 }
 
+func chooseBackupInteractive(title string) (backup Backup, err error) {
+	backups, err := getBackups()
+	if err != nil {
+		return
+	}
+	if len(backups) == 0 {
+		err = fmt.Errorf("%w: no backups yet", _errBackupNotFound)
+		return
+	}
+	var options []huh.Option[*Backup]
+	for i := range backups {
+		b := &backups[i]
+		text := b.String()
+		if b.Metadata.IsAutoSave {
+			// Dim auto backups.
+			text = lipgloss.NewStyle().Faint(true).Render(text)
+		}
+		options = append(options, huh.NewOption(text, b))
+	}
+	var chosen *Backup
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[*Backup]().
+				Title(title).
+				Options(options...).
+				Value(&chosen),
+		),
+	)
+	if err = form.Run(); err != nil {
+		err = fmt.Errorf("failed to get user selection: %w", err)
+		return
+	}
+	backup = *chosen
+	return
+}
+
+var _errVerificationFailed = errors.New("backups failed verification")
+
+// verifyBackups verifies the backups with the given IDs, or all backups if
+// none is given.
+func verifyBackups(ids []string) error {
+	var backups []Backup
+	if len(ids) == 0 {
+		var err error
+		if backups, err = getBackups(); err != nil {
+			return err
+		}
+	}
+	for _, id := range ids {
+		b, err := findBackup(id)
+		if err != nil {
+			return err
+		}
+		backups = append(backups, b)
+	}
+	var failed, unverifiable int
+	for _, b := range backups {
+		problems, err := verifyBackup(b)
+		if errors.Is(err, _errBackupUnverifiable) {
+			log.Warnf("%s: unverifiable: %s", filepath.Base(b.Dir), err)
+			unverifiable++
+			continue
+		}
+		if err != nil {
+			log.Errorf("failed to verify backup '%s': %s", b.Dir, err)
+			failed++
+			continue
+		}
+		if len(problems) == 0 {
+			log.Infof("%s: OK", filepath.Base(b.Dir))
+			continue
+		}
+		failed++
+		for _, p := range problems {
+			log.Errorf("%s: %s", filepath.Base(b.Dir), p)
+		}
+	}
+	if unverifiable > 0 {
+		log.Warnf("%d of %d backups are unverifiable", unverifiable, len(backups))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d %w", failed, len(backups), _errVerificationFailed)
+	}
+	return nil
+}
+
+// diffBackup compares the backup with the given ID (chosen interactively if
+// empty) with the current save.
+func diffBackup(id string) error {
+	var backup Backup
+	var err error
+	if id == "" {
+		backup, err = chooseBackupInteractive("Choose a backup to compare with the current save")
+	} else {
+		backup, err = findBackup(id)
+	}
+	if err != nil {
+		return err
+	}
+	diffs, err := backup.diffWithCurrentSave()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Comparing '%s' with current save:\n", backup)
+	for _, d := range diffs {
+		color := _green
+		if d.Status != _saveFileIdentical {
+			color = _yellow
+		}
+		fmt.Println(colored(color, d.String()))
+	}
+	return nil
+}
+
 func openSavesDirectory() {
 	if err := openDirectoryInExplorer(_eremiteGamesRootDirectory); err != nil {
 		log.Error(err)
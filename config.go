@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const _configFilename = "atss-config.json"
+
+// Config is read from atss-config.json in the backups root directory. Every
+// field is optional; command line flags take precedence.
+type Config struct {
+	Autosave AutosaveConfig `json:"autosave"`
+	// Maps hook names (see _hookNames) to commands to run.
+	Hooks map[string][]HookConfig `json:"hooks"`
+}
+
+type AutosaveConfig struct {
+	// Trigger policies deciding whether an updated save is backed up; see
+	// _autoBackupPolicies. A backup is created if any of them fires.
+	Triggers []string `json:"triggers"`
+	// N for the every-n trigger policy.
+	EveryN int `json:"everyN"`
+	// Go duration strings, e.g. 10s. Save updates are debounced by Debounce
+	// (default 5s), delaying up to MaxWait (default 30s). If StableFor is set,
+	// autosave waits for the save files to be unchanged for that long instead
+	// of debouncing.
+	Debounce  string `json:"debounce"`
+	MaxWait   string `json:"maxWait"`
+	StableFor string `json:"stableFor"`
+	// Throttling: minimum time between backups, e.g. 1m, and maximum number
+	// of backups per hour.
+	MinInterval string `json:"minInterval"`
+	MaxPerHour  int    `json:"maxPerHour"`
+	// Interval of scheduled snapshots while the game is running, e.g. 10m;
+	// disabled by default.
+	Interval string `json:"interval"`
+}
+
+// HookConfig is a command run on a hook, with the affected backup passed in
+// ATSS_* environment variables and as JSON on stdin.
+type HookConfig struct {
+	// Program and arguments, not interpreted by a shell.
+	Command []string `json:"command"`
+	// Go duration string, e.g. 10s; defaults to 30s.
+	Timeout string `json:"timeout"`
+}
+
+// parseDuration parses an optional duration setting.
+func parseDuration(name, value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': %w", name, value, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid %s '%s': must not be negative", name, value)
+	}
+	return d, nil
+}
+
+// getConfig returns the config, loaded once per process.
+var getConfig = sync.OnceValues(loadConfig)
+
+func loadConfig() (config Config, err error) {
+	file := filepath.Join(_backupsDirectory, _configFilename)
+	encoded, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+		err = fmt.Errorf("failed to read config file '%s': %w", file, err)
+		return
+	}
+	if err = json.Unmarshal(encoded, &config); err != nil {
+		err = fmt.Errorf("failed to decode config file '%s': %w", file, err)
+		return
+	}
+	for hook := range config.Hooks {
+		if !slices.Contains(_hookNames, hook) {
+			err = fmt.Errorf("unknown hook '%s' in config file '%s', expected one of %s",
+				hook, file, strings.Join(_hookNames, ", "))
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// A running autosave listens on a loopback port for control requests from
+// other AtSS invocations. The address and a random token are published in the
+// control file in the backups root directory, removed when autosave exits.
+const (
+	_autosaveControlFilename = "atss-autosave.ctl"
+	_autosaveControlTimeout  = time.Minute
+)
+
+var _errAutosaveNotRunning = errors.New("autosave is not running")
+
+type autosaveControl struct {
+	Addr  string `json:"addr"`
+	Token string `json:"token"`
+	PID   int    `json:"pid"`
+}
+
+type autosaveStatus struct {
+	PID           int          `json:"pid"`
+	StartedAt     time.Time    `json:"startedAt"`
+	Paused        bool         `json:"paused"`
+	Triggers      []string     `json:"triggers,omitempty"`
+	Updates       int          `json:"updates"`
+	PendingEvents int          `json:"pendingEvents"`
+	Session       *GameSession `json:"session,omitempty"`
+	LastBackup    *apiBackup   `json:"lastBackup,omitempty"`
+}
+
+type autosaveTriggerRequest struct {
+	Note string `json:"note"`
+}
+
+// serveAutosaveControl starts the control endpoint of the daemon in the
+// background. stop is called upon a stop request. The returned function shuts
+// the endpoint down.
+func serveAutosaveControl(d *autoBackupDaemon, stop func()) (shutdown func(), err error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for control requests: %w", err)
+	}
+	tokenBytes := make([]byte, 16)
+	_, _ = rand.Read(tokenBytes)
+	control := autosaveControl{
+		Addr:  listener.Addr().String(),
+		Token: hex.EncodeToString(tokenBytes),
+		PID:   os.Getpid(),
+	}
+	encoded, _ := json.Marshal(control)
+	file := filepath.Join(_backupsDirectory, _autosaveControlFilename)
+	if err := writeFileAtomic(file, encoded, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to write control file '%s': %w", file, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.status())
+	})
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		d.setPaused(true)
+		writeJSON(w, http.StatusOK, d.status())
+	})
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		d.setPaused(false)
+		writeJSON(w, http.StatusOK, d.status())
+	})
+	mux.HandleFunc("/trigger", func(w http.ResponseWriter, r *http.Request) {
+		var req autosaveTriggerRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		backup, err := d.backupNow(req.Note)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, newAPIBackup(backup))
+	})
+	mux.HandleFunc("/stop", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+		stop()
+	})
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(control.Token)) != 1 {
+				writeJSON(w, http.StatusUnauthorized, apiError{"invalid or missing token"})
+				return
+			}
+			if r.Method != http.MethodGet && r.Method != http.MethodPost {
+				writeJSON(w, http.StatusMethodNotAllowed, apiError{"method not allowed"})
+				return
+			}
+			mux.ServeHTTP(w, r)
+		}),
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("control endpoint error: %s", err)
+		}
+	}()
+	return func() {
+		_ = server.Close()
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Warnf("failed to remove control file '%s': %s", file, err)
+		}
+	}, nil
+}
+
+// callAutosave sends a control request to the running autosave, decoding the
+// response into result unless nil.
+func callAutosave(method, path string, body, result any) error {
+	file := filepath.Join(_backupsDirectory, _autosaveControlFilename)
+	encoded, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return _errAutosaveNotRunning
+	} else if err != nil {
+		return fmt.Errorf("failed to read control file '%s': %w", file, err)
+	}
+	var control autosaveControl
+	if err := json.Unmarshal(encoded, &control); err != nil {
+		return fmt.Errorf("failed to decode control file '%s': %w", file, err)
+	}
+
+	var reqBody bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&reqBody).Encode(body)
+	}
+	req, err := http.NewRequest(method, "http://"+control.Addr+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+control.Token)
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: _autosaveControlTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			// Left behind by an autosave that didn't exit cleanly.
+			return fmt.Errorf("%w (stale control file '%s')", _errAutosaveNotRunning, file)
+		}
+		return fmt.Errorf("failed to reach autosave: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiErr apiError
+		if json.NewDecoder(resp.Body).Decode(&apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = resp.Status
+		}
+		return fmt.Errorf("autosave: %s", apiErr.Error)
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode autosave response: %w", err)
+		}
+	}
+	return nil
+}
+
+func printAutosaveStatus(status autosaveStatus) {
+	state := "watching"
+	if status.Paused {
+		state = "paused"
+	}
+	fmt.Printf("Autosave: %s (PID %d, running since %s)\n", state, status.PID, status.StartedAt.Format("2006-01-02 15:04:05"))
+	triggers := "always"
+	if len(status.Triggers) > 0 {
+		triggers = strings.Join(status.Triggers, ", ")
+	}
+	fmt.Printf("Triggers: %s\n", triggers)
+	fmt.Printf("Save updates: %d, pending events: %d\n", status.Updates, status.PendingEvents)
+	if status.Session != nil {
+		fmt.Printf("Game: running since %s\n", status.Session.StartedAt.Format("2006-01-02 15:04:05"))
+	} else {
+		fmt.Println("Game: not running")
+	}
+	if status.LastBackup != nil {
+		fmt.Printf("Last backup: %s\n", status.LastBackup.ID)
+	}
+}
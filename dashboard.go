@@ -0,0 +1,530 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dustin/go-humanize"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// The autosave dashboard shows the history of backups along with recent
+// activity, and allows acting on backups while autosave is running.
+
+const (
+	// Number of recent reports kept for display.
+	_dashboardReportsKept = 100
+	// Default number of recent reports shown, if the window is tall enough.
+	_dashboardReportsShown = 6
+)
+
+type dashboardMode int
+
+const (
+	_dashboardBrowsing dashboardMode = iota
+	_dashboardEditingNote
+	_dashboardConfirmingRestore
+)
+
+type autoBackupReportMsg autoBackupReport
+
+type gameStatusMsg string
+
+// dashboardDataMsg carries freshly loaded backups and stats.
+type dashboardDataMsg struct {
+	backups   []Backup
+	season    SeasonId
+	diskUsage int64
+	err       error
+	// Modification time of the index before loading, zero if there was none.
+	indexModTime time.Time
+}
+
+// dashboardStopMsg asks the dashboard to quit, e.g. upon a stop request via
+// the control endpoint.
+type dashboardStopMsg struct{}
+
+// dashboardFinishedMsg tells that the pending save update is processed.
+type dashboardFinishedMsg struct{}
+
+// dashboardActionMsg is the outcome of an action on a backup.
+type dashboardActionMsg struct {
+	message string
+	err     error
+}
+
+type autoBackupTeaModel struct {
+	daemon       *autoBackupDaemon
+	reportsCh    <-chan autoBackupReport
+	reports      []autoBackupReport
+	gameStatusCh <-chan string
+	gameStatus   string
+	spinner      spinner.Model
+	noteInput    textinput.Model
+
+	data   dashboardDataMsg
+	cursor int
+	// Index of the first backup shown.
+	offset int
+	width  int
+	height int
+	mode   dashboardMode
+	// Whether an action is in progress; only one at a time.
+	busy bool
+	// Whether quitting was requested, pending the action in progress.
+	stopping bool
+	quitting bool
+}
+
+func autoBackupInitialModel(daemon *autoBackupDaemon, reportsCh <-chan autoBackupReport, gameStatusCh <-chan string) autoBackupTeaModel {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	input := textinput.New()
+	input.Prompt = "Note: "
+	input.CharLimit = 200
+	return autoBackupTeaModel{
+		daemon:       daemon,
+		reportsCh:    reportsCh,
+		gameStatusCh: gameStatusCh,
+		gameStatus:   "Game: checking...",
+		spinner:      s,
+		noteInput:    input,
+		height:       24,
+		width:        80,
+	}
+}
+
+func reportListenCmd(ch <-chan autoBackupReport) tea.Cmd {
+	// The command waits for and returns the next report from the channel.
+	return func() tea.Msg {
+		return autoBackupReportMsg(<-ch)
+	}
+}
+
+func gameStatusListenCmd(ch <-chan string) tea.Cmd {
+	return func() tea.Msg {
+		return gameStatusMsg(<-ch)
+	}
+}
+
+func loadDashboardDataCmd() tea.Msg {
+	var data dashboardDataMsg
+	data.indexModTime = indexModTime()
+	data.backups, data.err = getBackups()
+	saveData, err := readSave(_savesDirectory)
+	if err == nil {
+		data.season = saveData.SeasonId()
+	} else {
+		data.season = _invalidSeasonId
+	}
+	data.diskUsage = backupsDiskUsage(data.backups)
+	return data
+}
+
+func indexModTime() time.Time {
+	stat, err := os.Stat(filepath.Join(_backupsDirectory, _indexFilename))
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
+
+type backupSizeKey struct {
+	dir       string
+	createdAt time.Time
+}
+
+// Sizes of backup directories, which don't change once created apart from the
+// metadata file; the overwritten backup is told apart by its creation time.
+var (
+	_backupSizesMu sync.Mutex
+	_backupSizes   = make(map[backupSizeKey]int64)
+)
+
+// backupsDiskUsage returns the total size of the given backups, walking only
+// those not seen before.
+func backupsDiskUsage(backups []Backup) (usage int64) {
+	_backupSizesMu.Lock()
+	defer _backupSizesMu.Unlock()
+	for _, b := range backups {
+		key := backupSizeKey{b.Dir, b.Metadata.CreatedAt}
+		size, ok := _backupSizes[key]
+		if !ok {
+			_ = filepath.WalkDir(b.Dir, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					if info, err := d.Info(); err == nil {
+						size += info.Size()
+					}
+				}
+				return nil
+			})
+			_backupSizes[key] = size
+		}
+		usage += size
+	}
+	return
+}
+
+// dashboardActionCmd runs an action in the background, reporting its outcome.
+func dashboardActionCmd(action func() (string, error)) tea.Cmd {
+	return func() tea.Msg {
+		message, err := action()
+		return dashboardActionMsg{message, err}
+	}
+}
+
+func (m autoBackupTeaModel) Init() tea.Cmd {
+	return tea.Batch(reportListenCmd(m.reportsCh), gameStatusListenCmd(m.gameStatusCh), loadDashboardDataCmd, m.spinner.Tick)
+}
+
+func (m autoBackupTeaModel) selected() (Backup, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.data.backups) {
+		return Backup{}, false
+	}
+	return m.data.backups[m.cursor], true
+}
+
+func (m autoBackupTeaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m.quit()
+		}
+		switch m.mode {
+		case _dashboardEditingNote:
+			return m.updateEditingNote(msg)
+		case _dashboardConfirmingRestore:
+			return m.updateConfirmingRestore(msg)
+		default:
+			return m.updateBrowsing(msg)
+		}
+
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scrollToCursor()
+		return m, nil
+
+	case autoBackupReportMsg:
+		m.reports = append(m.reports, autoBackupReport(msg))
+		if len(m.reports) > _dashboardReportsKept {
+			m.reports = m.reports[len(m.reports)-_dashboardReportsKept:]
+		}
+		cmds := []tea.Cmd{reportListenCmd(m.reportsCh)}
+		if msg.Kind == _reportBackup {
+			cmds = append(cmds, loadDashboardDataCmd)
+		}
+		return m, tea.Batch(cmds...)
+
+	case gameStatusMsg:
+		m.gameStatus = string(msg)
+		return m, gameStatusListenCmd(m.gameStatusCh)
+
+	case dashboardDataMsg:
+		// Keep the same backup selected as the list changes.
+		selected, ok := m.selected()
+		m.data = msg
+		m.cursor = 0
+		if ok {
+			for i, b := range m.data.backups {
+				if b.Dir == selected.Dir {
+					m.cursor = i
+					break
+				}
+			}
+		}
+		m.scrollToCursor()
+		return m, nil
+
+	case dashboardActionMsg:
+		m.busy = false
+		report := autoBackupReport{Time: time.Now(), Kind: _reportInfo, Message: msg.message}
+		if msg.err != nil {
+			report.Kind, report.Message = _reportError, msg.err.Error()
+		}
+		if report.Message != "" {
+			m.reports = append(m.reports, report)
+		}
+		if m.stopping {
+			m.busy = true
+			return m, m.finishCmd()
+		}
+		return m, loadDashboardDataCmd
+
+	case dashboardStopMsg:
+		return m.quit()
+
+	case dashboardFinishedMsg:
+		m.quitting = true
+		return m, tea.Quit
+
+	default:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+}
+
+// quit quits once the action in progress, if any, is done, like the app, since
+// a restore interrupted by exiting would leave the saves half restored. The
+// pending save update is processed first, as when headless autosave stops.
+func (m autoBackupTeaModel) quit() (tea.Model, tea.Cmd) {
+	if m.stopping {
+		return m, nil
+	}
+	m.stopping = true
+	if m.busy {
+		m.reports = append(m.reports, autoBackupReport{Time: time.Now(), Kind: _reportInfo,
+			Message: "quitting once the current action finishes"})
+		return m, nil
+	}
+	m.busy = true
+	return m, m.finishCmd()
+}
+
+func (m autoBackupTeaModel) finishCmd() tea.Cmd {
+	daemon := m.daemon
+	return func() tea.Msg {
+		log.Info("stopping, finishing pending backup if any")
+		daemon.finish()
+		return dashboardFinishedMsg{}
+	}
+}
+
+func (m autoBackupTeaModel) updateBrowsing(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m.quit()
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.data.backups)-1 {
+			m.cursor++
+		}
+	case "pgup":
+		m.cursor = max(m.cursor-m.listHeight(), 0)
+	case "pgdown":
+		m.cursor = max(min(m.cursor+m.listHeight(), len(m.data.backups)-1), 0)
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = max(len(m.data.backups)-1, 0)
+	case "b":
+		if m.busy {
+			return m, nil
+		}
+		m.busy = true
+		return m, dashboardActionCmd(func() (string, error) {
+			// The daemon reports the outcome itself.
+			_, _ = m.daemon.backupNow("")
+			return "", nil
+		})
+	case "n":
+		if backup, ok := m.selected(); ok && !m.busy {
+			m.mode = _dashboardEditingNote
+			m.noteInput.SetValue(backup.Metadata.Note)
+			m.noteInput.CursorEnd()
+			return m, m.noteInput.Focus()
+		}
+	case "p":
+		if backup, ok := m.selected(); ok && !m.busy {
+			m.busy = true
+			return m, dashboardActionCmd(func() (string, error) {
+				backup, err := pinBackup(backup, !backup.Metadata.Pinned)
+				if err != nil {
+					return "", err
+				}
+				if backup.Metadata.Pinned {
+					return fmt.Sprintf("pinned %s", filepath.Base(backup.Dir)), nil
+				}
+				return fmt.Sprintf("unpinned %s", filepath.Base(backup.Dir)), nil
+			})
+		}
+	case "r":
+		if _, ok := m.selected(); ok && !m.busy {
+			m.mode = _dashboardConfirmingRestore
+		}
+	}
+	m.scrollToCursor()
+	return m, nil
+}
+
+func (m autoBackupTeaModel) updateEditingNote(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.mode = _dashboardBrowsing
+		m.noteInput.Blur()
+		return m, nil
+	case "enter":
+		m.mode = _dashboardBrowsing
+		m.noteInput.Blur()
+		backup, ok := m.selected()
+		if !ok {
+			return m, nil
+		}
+		note := strings.TrimSpace(m.noteInput.Value())
+		m.busy = true
+		return m, dashboardActionCmd(func() (string, error) {
+			if _, err := annotateBackup(backup, note); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("updated note of %s", filepath.Base(backup.Dir)), nil
+		})
+	}
+	var cmd tea.Cmd
+	m.noteInput, cmd = m.noteInput.Update(msg)
+	return m, cmd
+}
+
+func (m autoBackupTeaModel) updateConfirmingRestore(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.mode = _dashboardBrowsing
+	backup, ok := m.selected()
+	if msg.String() != "y" || !ok {
+		return m, nil
+	}
+	m.busy = true
+	return m, dashboardActionCmd(func() (string, error) {
+		// The usual checks apply: hooks may veto, and the restore is refused
+		// if the game needs to be restarted but is running.
+		autoBackup, err := restoreBackup(backup, restoreScope{})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("restored %s, previous state backed up to %s",
+			filepath.Base(backup.Dir), filepath.Base(autoBackup.Dir)), nil
+	})
+}
+
+// listHeight is the number of backups shown at once.
+func (m autoBackupTeaModel) listHeight() int {
+	// Title, list header, blank lines, reports, prompt, status bar and help.
+	return max(m.height-9-m.reportsShown(), 3)
+}
+
+func (m autoBackupTeaModel) reportsShown() int {
+	return min(_dashboardReportsShown, max(m.height/4, 1))
+}
+
+func (m *autoBackupTeaModel) scrollToCursor() {
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if h := m.listHeight(); m.cursor >= m.offset+h {
+		m.offset = m.cursor - h + 1
+	}
+}
+
+func (m autoBackupTeaModel) View() string {
+	if m.quitting {
+		return ""
+	}
+	faint := lipgloss.NewStyle().Faint(true)
+	bar := lipgloss.NewStyle().Reverse(true).Width(m.width)
+	var sb strings.Builder
+
+	state := "Watching for save updates"
+	if m.daemon.isPaused() {
+		state = "Paused"
+	}
+	if len(m.daemon.options.Triggers) > 0 {
+		state += fmt.Sprintf(" (triggers: %s)", strings.Join(m.daemon.options.Triggers, ", "))
+	}
+	fmt.Fprintf(&sb, "%s %s; please keep this window open.\n\n", m.spinner.View(), state)
+
+	fmt.Fprintf(&sb, "Backups (%d-%d of %d):\n",
+		min(m.offset+1, len(m.data.backups)), min(m.offset+m.listHeight(), len(m.data.backups)), len(m.data.backups))
+	for i := m.offset; i < len(m.data.backups) && i < m.offset+m.listHeight(); i++ {
+		line := "  " + m.data.backups[i].String()
+		if i == m.cursor {
+			line = "> " + m.data.backups[i].String()
+		}
+		sb.WriteString(lipgloss.NewStyle().MaxWidth(m.width).Render(line))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+
+	reports := m.reports[max(len(m.reports)-m.reportsShown(), 0):]
+	for _, r := range reports {
+		sb.WriteString(lipgloss.NewStyle().MaxWidth(m.width).Render(r.render()))
+		sb.WriteString("\n")
+	}
+	for i := len(reports); i < m.reportsShown(); i++ {
+		sb.WriteString("\n")
+	}
+
+	switch {
+	case m.mode == _dashboardEditingNote:
+		sb.WriteString(m.noteInput.View())
+	case m.mode == _dashboardConfirmingRestore:
+		backup, _ := m.selected()
+		fmt.Fprintf(&sb, "Restore %s? An auto backup of the current save is created first. (y/N)", backup)
+	case m.busy:
+		sb.WriteString(faint.Render("Working..."))
+	}
+	sb.WriteString("\n")
+
+	status := fmt.Sprintf("Current: %s | %d backups, %s | %s",
+		m.data.season, len(m.data.backups), humanize.Bytes(uint64(m.data.diskUsage)), m.gameStatus)
+	if m.data.err != nil {
+		status += fmt.Sprintf(" | %s", m.data.err)
+	}
+	sb.WriteString(bar.Render(status))
+	sb.WriteString("\n")
+	sb.WriteString(faint.Render("↑/↓ select • n note • p pin • r restore • b backup now • q quit"))
+	return sb.String()
+}
+
+func (r autoBackupReport) render() string {
+	if r.Kind == _reportBackup || r.Kind == _reportLog {
+		return r.Message
+	}
+	line := fmt.Sprintf("[%s] %s", r.Time.Format("2006-01-02 15:04:05"), r.Message)
+	switch r.Kind {
+	case _reportEvent:
+		return colored(_yellow, line)
+	case _reportSkipped:
+		return lipgloss.NewStyle().Faint(true).Render(line)
+	case _reportError:
+		return colored(_red, line)
+	default:
+		return colored(_blue, line)
+	}
+}
+
+type autoBackupTUIReporter struct {
+	reportsCh    chan<- autoBackupReport
+	gameStatusCh chan<- string
+}
+
+func (t autoBackupTUIReporter) report(r autoBackupReport) {
+	t.reportsCh <- r
+}
+
+func (t autoBackupTUIReporter) setGameStatus(status string) {
+	t.gameStatusCh <- status
+}
+
+// autoBackupLogWriter shows log lines as reports while the dashboard is
+// displayed, since they would otherwise garble it.
+type autoBackupLogWriter struct {
+	reportsCh chan<- autoBackupReport
+}
+
+func (w autoBackupLogWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.reportsCh <- autoBackupReport{Time: time.Now(), Kind: _reportLog, Message: line}
+	}
+	return len(p), nil
+}
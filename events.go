@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// Events are appended to this file in the backups root directory as JSON lines.
+const _eventLogFilename = "atss-events.jsonl"
+
+type SaveEventType string
+
+const (
+	_eventEmbarked        SaveEventType = "embarked"
+	_eventSeasonAdvanced  SaveEventType = "season-advanced"
+	_eventSettlementWon   SaveEventType = "settlement-won"
+	_eventSettlementLost  SaveEventType = "settlement-lost"
+	_eventSettlementEnded SaveEventType = "settlement-ended" // Outcome unknown
+	_eventNewCycle        SaveEventType = "new-cycle"
+	_eventQuitToMenu      SaveEventType = "quit-to-menu"
+)
+
+// SaveEvent is something that happened in game, as inferred from comparing
+// consecutive save states.
+type SaveEvent struct {
+	Type        SaveEventType `json:"type"`
+	Description string        `json:"description"`
+	Time        time.Time     `json:"time"`
+	Season      SeasonId      `json:"season"`
+}
+
+// saveSnapshot is the save state observed by autosave at one point.
+type saveSnapshot struct {
+	Save  CompositeSave
+	World RawWorldSave
+	Valid bool // Whether Save could be read; World is best effort
+}
+
+func takeSaveSnapshot(dir string) (snapshot saveSnapshot, err error) {
+	snapshot.Save, err = readSave(dir)
+	if err != nil {
+		return
+	}
+	snapshot.Valid = true
+	if snapshot.World, err = readWorldSave(dir); err != nil {
+		log.Debugf("ignoring world save for event detection: %s", err)
+		snapshot.World, err = RawWorldSave{}, nil
+	}
+	return
+}
+
+func (s saveSnapshot) hasActiveGame() bool {
+	return s.Save.SeasonId() > 0
+}
+
+func (s saveSnapshot) biome() string {
+	if g := s.Save.Save.Gameplay; g != nil && g.Biome != nil {
+		return *g.Biome
+	}
+	return ""
+}
+
+// outcome returns the outcome of the settlement, _eventSettlementEnded if
+// unknown.
+func (s saveSnapshot) outcome() SaveEventType {
+	g := s.Save.Save.Gameplay
+	switch {
+	case g != nil && g.IsGameWon != nil && *g.IsGameWon:
+		return _eventSettlementWon
+	case g != nil && g.IsGameLost != nil && *g.IsGameLost:
+		return _eventSettlementLost
+	}
+	return _eventSettlementEnded
+}
+
+func (s saveSnapshot) cycle() (cycle int, ok bool) {
+	if g := s.World.Gameplay; g != nil && g.Cycle != nil {
+		return *g.Cycle, true
+	}
+	return 0, false
+}
+
+// detectSaveEvents infers what happened in game between two snapshots. The
+// fields that the season ID is derived from are required; detection relying
+// on the optional ones (biome, outcome and cycle) is skipped or falls back to
+// less detail if they're absent.
+func detectSaveEvents(prev, cur saveSnapshot, now time.Time) (events []SaveEvent) {
+	if !prev.Valid || !cur.Valid {
+		return
+	}
+	season := cur.Save.SeasonId()
+	emit := func(t SaveEventType, format string, a ...any) {
+		events = append(events, SaveEvent{
+			Type:        t,
+			Description: fmt.Sprintf(format, a...),
+			Time:        now,
+			Season:      season,
+		})
+	}
+
+	prevCycle, prevCycleOk := prev.cycle()
+	curCycle, curCycleOk := cur.cycle()
+	if prevCycleOk && curCycleOk && curCycle > prevCycle {
+		emit(_eventNewCycle, "started cycle %d", curCycle)
+	}
+
+	prevSeason := prev.Save.SeasonId()
+	switch {
+	case !prev.hasActiveGame() && cur.hasActiveGame():
+		if biome := cur.biome(); biome != "" {
+			emit(_eventEmbarked, "embarked to %s", biome)
+		} else {
+			emit(_eventEmbarked, "embarked to a new settlement")
+		}
+	case prev.hasActiveGame() && !cur.hasActiveGame():
+		// The outcome may only be recorded in the last save of the
+		// settlement.
+		outcome := cur.outcome()
+		if outcome == _eventSettlementEnded {
+			outcome = prev.outcome()
+		}
+		switch outcome {
+		case _eventSettlementWon:
+			emit(outcome, "settlement won in %s", prevSeason)
+		case _eventSettlementLost:
+			emit(outcome, "settlement lost in %s", prevSeason)
+		default:
+			emit(outcome, "settlement ended in %s", prevSeason)
+		}
+	case prev.hasActiveGame() && cur.hasActiveGame():
+		if season > prevSeason {
+			emit(_eventSeasonAdvanced, "season advanced to %s", season)
+		} else if season == prevSeason {
+			// The game saves on season changes and when quitting, so a save
+			// within the same season is most likely a save and quit.
+			emit(_eventQuitToMenu, "saved and quit to menu in %s", season)
+		}
+	}
+	return
+}
+
+func appendEventLog(events []SaveEvent) error {
+	values := make([]any, len(events))
+	for i, e := range events {
+		values[i] = e
+	}
+	return appendJSONLines(filepath.Join(_backupsDirectory, _eventLogFilename), values...)
+}
+
+// describeSaveEvents summarizes events into a backup note.
+func describeSaveEvents(events []SaveEvent) string {
+	var descriptions []string
+	for _, e := range events {
+		descriptions = append(descriptions, e.Description)
+	}
+	return strings.Join(descriptions, "; ")
+}
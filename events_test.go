@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDetectSaveEvents(t *testing.T) {
+	// snapshot takes a snapshot of a save with the given Save.save gameplay
+	// fields beyond year and season, and cycle in WorldSave.save unless 0.
+	snapshot := func(hasActiveGame bool, year, season int, extra string, cycle int) saveSnapshot {
+		dir := t.TempDir()
+		writeTestSave(t, dir, hasActiveGame, year, season)
+		content := fmt.Sprintf(`{"gameplay":{"year":%d,"season":%d%s}}`, year, season, extra)
+		if err := os.WriteFile(filepath.Join(dir, "Save.save"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if cycle > 0 {
+			content := fmt.Sprintf(`{"gameplay":{"cycle":%d}}`, cycle)
+			if err := os.WriteFile(filepath.Join(dir, "WorldSave.save"), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s, err := takeSaveSnapshot(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	worldMap := snapshot(false, 1, 0, "", 0)
+	y1Drizzle := snapshot(true, 1, 0, "", 0)
+	y1Storm := snapshot(true, 1, 2, "", 0)
+	y2Drizzle := snapshot(true, 2, 0, "", 0)
+
+	tests := []struct {
+		name     string
+		prev     saveSnapshot
+		cur      saveSnapshot
+		want     []SaveEventType
+		wantDesc []string
+	}{
+		{"embarked", worldMap, y1Drizzle, []SaveEventType{_eventEmbarked}, []string{"embarked to a new settlement"}},
+		{"embarked to biome", worldMap, snapshot(true, 1, 0, `,"biome":"Coral Forest"`, 0),
+			[]SaveEventType{_eventEmbarked}, []string{"embarked to Coral Forest"}},
+		{"season advanced", y1Drizzle, y1Storm, []SaveEventType{_eventSeasonAdvanced}, []string{"season advanced to Y1 storm"}},
+		{"year advanced", y1Storm, y2Drizzle, []SaveEventType{_eventSeasonAdvanced}, []string{"season advanced to Y2 drizzle"}},
+		{"settlement ended", y1Storm, worldMap, []SaveEventType{_eventSettlementEnded}, []string{"settlement ended in Y1 storm"}},
+		{"settlement won", y1Storm, snapshot(false, 1, 2, `,"isGameWon":true`, 0),
+			[]SaveEventType{_eventSettlementWon}, []string{"settlement won in Y1 storm"}},
+		{"settlement won before leaving", snapshot(true, 1, 2, `,"isGameWon":true`, 0), worldMap,
+			[]SaveEventType{_eventSettlementWon}, []string{"settlement won in Y1 storm"}},
+		{"settlement lost", y2Drizzle, snapshot(false, 2, 0, `,"isGameWon":false,"isGameLost":true`, 0),
+			[]SaveEventType{_eventSettlementLost}, []string{"settlement lost in Y2 drizzle"}},
+		{"new cycle", snapshot(false, 1, 0, "", 3), snapshot(false, 1, 0, "", 4),
+			[]SaveEventType{_eventNewCycle}, []string{"started cycle 4"}},
+		{"same cycle", snapshot(false, 1, 0, "", 3), snapshot(false, 1, 0, "", 3), nil, nil},
+		{"cycle unknown", worldMap, snapshot(false, 1, 0, "", 4), nil, nil},
+		{"quit to menu", y1Storm, y1Storm, []SaveEventType{_eventQuitToMenu}, []string{"saved and quit to menu in Y1 storm"}},
+		{"season went back", y2Drizzle, y1Storm, nil, nil},
+		{"still on world map", worldMap, worldMap, nil, nil},
+		{"previous unreadable", saveSnapshot{}, y1Drizzle, nil, nil},
+		{"current unreadable", y1Drizzle, saveSnapshot{}, nil, nil},
+	}
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []SaveEventType
+			var gotDesc []string
+			for _, e := range detectSaveEvents(tt.prev, tt.cur, now) {
+				got = append(got, e.Type)
+				gotDesc = append(gotDesc, e.Description)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(gotDesc, tt.wantDesc) {
+				t.Errorf("descriptions = %q, want %q", gotDesc, tt.wantDesc)
+			}
+		})
+	}
+}
+
+func TestTakeSaveSnapshotValidatesOptionalFields(t *testing.T) {
+	tests := []struct {
+		name      string
+		save      string
+		world     string
+		wantErr   bool
+		wantCycle bool
+	}{
+		{"all fields", `{"gameplay":{"year":1,"season":0,"biome":"Royal Woodlands","isGameWon":false,"isGameLost":false}}`, `{"gameplay":{"cycle":2}}`, false, true},
+		{"optional fields absent", `{"gameplay":{"year":1,"season":0}}`, `{}`, false, false},
+		{"invalid biome", fmt.Sprintf(`{"gameplay":{"year":1,"season":0,"biome":"%0120d"}}`, 0), `{}`, true, false},
+		{"invalid cycle is ignored", `{"gameplay":{"year":1,"season":0}}`, `{"gameplay":{"cycle":0}}`, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestSave(t, dir, true, 1, 0)
+			writeTestFile(t, filepath.Join(dir, "Save.save"), tt.save)
+			writeTestFile(t, filepath.Join(dir, "WorldSave.save"), tt.world)
+			s, err := takeSaveSnapshot(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %t", err, tt.wantErr)
+			}
+			if _, ok := s.cycle(); ok != tt.wantCycle {
+				t.Errorf("cycle known = %t, want %t", ok, tt.wantCycle)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ require (
 	github.com/zmwangx/debounce v1.0.0
 	golang.org/x/crypto v0.19.0
 	golang.org/x/sys v0.18.0
+	golang.org/x/term v0.17.0
 )
 
 require (
@@ -41,6 +42,5 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/sync v0.4.0 // indirect
-	golang.org/x/term v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// Hooks are user commands run before and after operations, configured in the
+// hooks section of the config file. A failing pre hook vetoes the operation;
+// a failing post hook is only reported.
+const (
+	_hookPreSave        = "pre-save"
+	_hookPostSave       = "post-save"
+	_hookPreAutosave    = "pre-autosave"
+	_hookPostAutosave   = "post-autosave"
+	_hookPreRestore     = "pre-restore"
+	_hookPostRestore    = "post-restore"
+	_hookPreDelete      = "pre-delete"
+	_hookPostDelete     = "post-delete"
+	_defaultHookTimeout = 30 * time.Second
+	// How long to wait for the output of a hook once it has exited or been
+	// killed, in case processes it started still hold the output pipe.
+	_hookWaitDelay = 5 * time.Second
+)
+
+var _hookNames = []string{
+	_hookPreSave, _hookPostSave,
+	_hookPreAutosave, _hookPostAutosave,
+	_hookPreRestore, _hookPostRestore,
+	_hookPreDelete, _hookPostDelete,
+}
+
+var _errVetoedByHook = errors.New("vetoed by hook")
+
+// hookPayload is passed to hook commands as JSON on stdin.
+type hookPayload struct {
+	Hook   string        `json:"hook"`
+	Backup hookBackup    `json:"backup"`
+	Scope  *restoreScope `json:"scope,omitempty"` // For restore hooks
+}
+
+type hookBackup struct {
+	Dir      string         `json:"dir"`
+	Metadata BackupMetadata `json:"metadata"`
+}
+
+// runHooks runs the commands configured for the hook one by one. For pre
+// hooks, the first failure, or failing to load the config, stops the rest and
+// returns an error wrapping _errVetoedByHook. Failures of post hooks are
+// logged.
+func runHooks(hook string, backup Backup, scope *restoreScope) error {
+	isPre := strings.HasPrefix(hook, "pre-")
+	config, err := getConfig()
+	if err != nil {
+		// Pre hooks may veto, so they can't be skipped silently; the
+		// operation is vetoed until the config is fixed.
+		if isPre {
+			return fmt.Errorf("%w %s: can't load hooks: %w", _errVetoedByHook, hook, err)
+		}
+		log.Warnf("not running %s hooks: %s", hook, err)
+		return nil
+	}
+	payload, err := json.Marshal(hookPayload{
+		Hook:   hook,
+		Backup: hookBackup{Dir: backup.Dir, Metadata: backup.Metadata},
+		Scope:  scope,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode payload for %s hooks: %w", hook, err)
+	}
+	for _, h := range config.Hooks[hook] {
+		err := runHook(hook, h, backup, payload)
+		if err == nil {
+			continue
+		}
+		if isPre {
+			return fmt.Errorf("%w %s: %w", _errVetoedByHook, hook, err)
+		}
+		log.Warnf("%s hook failed: %s", hook, err)
+	}
+	return nil
+}
+
+func runHook(hook string, h HookConfig, backup Backup, payload []byte) error {
+	if len(h.Command) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	timeout := _defaultHookTimeout
+	if h.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(h.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout '%s': %w", h.Timeout, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var season string
+	if backup.Metadata.Season != nil {
+		season = backup.Metadata.Season.String()
+	}
+	log.Debugf("running %s hook '%s' with timeout %s", hook, strings.Join(h.Command, " "), timeout)
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"ATSS_HOOK="+hook,
+		"ATSS_SAVES_DIR="+_savesDirectory,
+		"ATSS_BACKUPS_DIR="+_backupsDirectory,
+		"ATSS_BACKUP_DIR="+backup.Dir,
+		"ATSS_BACKUP_CREATED_AT="+backup.Metadata.CreatedAt.Format(time.RFC3339),
+		"ATSS_BACKUP_NOTE="+backup.Metadata.Note,
+		"ATSS_BACKUP_SEASON="+season,
+		"ATSS_BACKUP_ORIGIN="+string(backup.Metadata.Origin),
+	)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.WaitDelay = _hookWaitDelay
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("'%s' timed out after %s", strings.Join(h.Command, " "), timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("'%s' failed: %w\n%s", strings.Join(h.Command, " "), err, bytes.TrimSpace(output))
+	}
+	log.Infof("ran %s hook '%s'", hook, strings.Join(h.Command, " "))
+	return nil
+}
+
+// backupHooks returns the pre and post hooks for creating the backup, which
+// depend on its kind. Overwritten backups are part of a restore, so they
+// don't have hooks of their own.
+func backupHooks(metadata BackupMetadata) (pre, post string) {
+	switch {
+	case metadata.IsOverwritten:
+		return "", ""
+	case metadata.IsAutoSave:
+		return _hookPreAutosave, _hookPostAutosave
+	default:
+		return _hookPreSave, _hookPostSave
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestHookHelperProcess isn't a real test, but a hook command run by the tests
+// below through the test binary. It checks its payload, then sleeps and exits
+// as told by its arguments.
+func TestHookHelperProcess(t *testing.T) {
+	if os.Getenv("ATSS_TEST_HOOK_HELPER") != "1" {
+		return
+	}
+	var payload hookPayload
+	if err := json.NewDecoder(os.Stdin).Decode(&payload); err != nil || payload.Hook != os.Getenv("ATSS_HOOK") {
+		os.Exit(100)
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	sleep, _ := time.ParseDuration(args[1])
+	time.Sleep(sleep)
+	code, _ := strconv.Atoi(args[2])
+	os.Exit(code)
+}
+
+func hookHelperCommand(sleep string, exitCode int) HookConfig {
+	return HookConfig{Command: []string{os.Args[0], "-test.run=^TestHookHelperProcess$", "--", sleep, strconv.Itoa(exitCode)}}
+}
+
+func TestRunHooks(t *testing.T) {
+	useTestBackupsDirectory(t)
+	t.Setenv("ATSS_TEST_HOOK_HELPER", "1")
+	prevGetConfig := getConfig
+	t.Cleanup(func() { getConfig = prevGetConfig })
+
+	timingOut := hookHelperCommand("10s", 0)
+	timingOut.Timeout = "200ms"
+	invalidTimeout := hookHelperCommand("0s", 0)
+	invalidTimeout.Timeout = "soon"
+	configErr := errors.New("failed to decode config file")
+
+	tests := []struct {
+		name      string
+		hook      string
+		hooks     []HookConfig
+		configErr error
+		wantVeto  bool
+	}{
+		{"none configured", _hookPreSave, nil, nil, false},
+		{"pre hooks succeed", _hookPreRestore, []HookConfig{hookHelperCommand("0s", 0), hookHelperCommand("0s", 0)}, nil, false},
+		{"pre hook fails", _hookPreRestore, []HookConfig{hookHelperCommand("0s", 0), hookHelperCommand("0s", 1)}, nil, true},
+		{"pre hook times out", _hookPreDelete, []HookConfig{timingOut}, nil, true},
+		{"pre hook has invalid timeout", _hookPreSave, []HookConfig{invalidTimeout}, nil, true},
+		{"pre hook has empty command", _hookPreSave, []HookConfig{{}}, nil, true},
+		{"pre hooks with config error", _hookPreSave, nil, configErr, true},
+		{"post hook failure is only logged", _hookPostSave, []HookConfig{hookHelperCommand("0s", 1)}, nil, false},
+		{"post hooks with config error", _hookPostDelete, nil, configErr, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{Hooks: map[string][]HookConfig{tt.hook: tt.hooks}}
+			getConfig = func() (Config, error) { return config, tt.configErr }
+			err := runHooks(tt.hook, Backup{Dir: "Bak.test"}, nil)
+			if vetoed := errors.Is(err, _errVetoedByHook); vetoed != tt.wantVeto {
+				t.Errorf("runHooks = %v, want vetoed %t", err, tt.wantVeto)
+			}
+			if err != nil && !tt.wantVeto {
+				t.Errorf("runHooks = %v, want no error", err)
+			}
+			if tt.wantVeto && exitCode(err) != _exitValidationFailed {
+				t.Errorf("exit code = %d, want %d", exitCode(err), _exitValidationFailed)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// The index caches the metadata of all backups in the backups root directory,
+// so that listing backups doesn't need to visit every backup directory.
+const (
+	_indexFilename = "atss-index.json"
+	_indexVersion  = 2
+)
+
+type backupIndex struct {
+	Version int `json:"version"`
+	// Metadata schema version of the binary that built the index. The index is
+	// rebuilt when this doesn't match, so that migrations are picked up.
+	SchemaVersion int                `json:"schemaVersion"`
+	Backups       []backupIndexEntry `json:"backups"`
+	// Backup directories that failed to load, recorded so that their presence
+	// doesn't render the index stale.
+	Invalid []backupIndexInvalidEntry `json:"invalid,omitempty"`
+}
+
+type backupIndexEntry struct {
+	Dirname string `json:"dirname"`
+	// Modification time of the metadata file when indexed, zero if there was
+	// none. The entry is stale once this changes.
+	ModTime  time.Time      `json:"modTime"`
+	Metadata BackupMetadata `json:"metadata"`
+}
+
+type backupIndexInvalidEntry struct {
+	Dirname string    `json:"dirname"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// metadataModTime returns the modification time of the metadata file in a
+// backup directory, zero if it can't be stat'ed.
+func metadataModTime(dir string) time.Time {
+	stat, err := os.Stat(filepath.Join(dir, _metadataFilename))
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
+
+func readBackupIndex() (index backupIndex, err error) {
+	file := filepath.Join(_backupsDirectory, _indexFilename)
+	encoded, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(encoded, &index); err != nil {
+		err = fmt.Errorf("failed to decode backup index '%s': %w", file, err)
+		return
+	}
+	if index.Version != _indexVersion || index.SchemaVersion != _metadataSchemaVersion {
+		err = fmt.Errorf("backup index '%s' is outdated", file)
+	}
+	return
+}
+
+func writeBackupIndex(index backupIndex) error {
+	index.Version = _indexVersion
+	index.SchemaVersion = _metadataSchemaVersion
+	encoded, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode backup index: %w", err)
+	}
+	file := filepath.Join(_backupsDirectory, _indexFilename)
+	if err := writeFileAtomic(file, encoded, 0o644); err != nil {
+		return fmt.Errorf("failed to write backup index '%s': %w", file, err)
+	}
+	return nil
+}
+
+// staleDirs returns those of the given backup directories that the index
+// doesn't cover, or whose metadata file changed since they were indexed.
+// extra reports whether the index also covers directories not given.
+func (index backupIndex) staleDirs(dirs []string) (stale []string, extra bool) {
+	indexed := make(map[string]time.Time, len(index.Backups)+len(index.Invalid))
+	for _, e := range index.Backups {
+		indexed[e.Dirname] = e.ModTime
+	}
+	for _, e := range index.Invalid {
+		indexed[e.Dirname] = e.ModTime
+	}
+	var covered int
+	for _, dir := range dirs {
+		modTime, ok := indexed[filepath.Base(dir)]
+		if ok {
+			covered++
+		}
+		if !ok || !modTime.Equal(metadataModTime(dir)) {
+			stale = append(stale, dir)
+		}
+	}
+	return stale, covered != len(indexed)
+}
+
+// isUpToDate reports whether the index covers exactly the given backup
+// directories, each as of its current metadata file.
+func (index backupIndex) isUpToDate(dirs []string) bool {
+	stale, extra := index.staleDirs(dirs)
+	return len(stale) == 0 && !extra
+}
+
+// refresh brings the index up to date with the given backup directories,
+// loading only the stale ones.
+func (index *backupIndex) refresh(dirs []string) {
+	stale, _ := index.staleDirs(dirs)
+	present := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		present[filepath.Base(dir)] = true
+	}
+	for _, dir := range stale {
+		present[filepath.Base(dir)] = false
+	}
+	index.Backups = slices.DeleteFunc(index.Backups, func(e backupIndexEntry) bool {
+		return !present[e.Dirname]
+	})
+	index.Invalid = slices.DeleteFunc(index.Invalid, func(e backupIndexInvalidEntry) bool {
+		return !present[e.Dirname]
+	})
+	if len(stale) == 0 {
+		return
+	}
+	log.Debugf("loading %d new or changed backup directories", len(stale))
+	_, loaded := loadBackupDirs(stale)
+	index.Backups = append(index.Backups, loaded.Backups...)
+	index.Invalid = append(index.Invalid, loaded.Invalid...)
+}
+
+func (index backupIndex) backups() []Backup {
+	backups := make([]Backup, 0, len(index.Backups))
+	for _, e := range index.Backups {
+		backups = append(backups, Backup{
+			Metadata: e.Metadata,
+			Dir:      filepath.Join(_backupsDirectory, e.Dirname),
+		})
+	}
+	return backups
+}
+
+func (index *backupIndex) put(backup Backup) {
+	dirname := filepath.Base(backup.Dir)
+	index.remove(dirname)
+	index.Backups = append(index.Backups, backupIndexEntry{
+		Dirname:  dirname,
+		ModTime:  metadataModTime(backup.Dir),
+		Metadata: backup.Metadata,
+	})
+}
+
+func (index *backupIndex) putInvalid(dir string) {
+	dirname := filepath.Base(dir)
+	index.remove(dirname)
+	index.Invalid = append(index.Invalid, backupIndexInvalidEntry{
+		Dirname: dirname,
+		ModTime: metadataModTime(dir),
+	})
+}
+
+func (index *backupIndex) remove(dirname string) {
+	index.Backups = slices.DeleteFunc(index.Backups, func(e backupIndexEntry) bool {
+		return e.Dirname == dirname
+	})
+	index.Invalid = slices.DeleteFunc(index.Invalid, func(e backupIndexInvalidEntry) bool {
+		return e.Dirname == dirname
+	})
+}
+
+// updateBackupIndex applies an incremental update to the index, after a backup
+// is created, changed or deleted, and reloads any other stale entries. If the
+// index can't be read, it is rebuilt instead. The store lock must be held.
+func updateBackupIndex(update func(index *backupIndex)) backupIndex {
+	dirs, _ := filepath.Glob(filepath.Join(_backupsDirectory, "Bak.*"))
+	index, err := readBackupIndex()
+	if err != nil {
+		index = backupIndex{}
+	}
+	update(&index)
+	index.refresh(dirs)
+	if err := writeBackupIndex(index); err != nil {
+		log.Warn(err)
+	}
+	return index
+}
+
+// rebuildBackupIndex loads the given backup directories, and writes a fresh
+// index. The store lock must be held.
+func rebuildBackupIndex(dirs []string) (backups []Backup, err error) {
+	backups, index := loadBackupDirs(dirs)
+	err = writeBackupIndex(index)
+	return
+}
+
+// loadBackupDirs loads the given backup directories concurrently, returning
+// the backups and an index of them.
+func loadBackupDirs(dirs []string) (backups []Backup, index backupIndex) {
+	type result struct {
+		backup  Backup
+		repairs []string
+		err     error
+	}
+	results := make([]result, len(dirs))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.NumCPU())
+	for i, dir := range dirs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, dir string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			backup, repairs, err := inspectBackup(dir)
+			results[i] = result{backup, repairs, err}
+		}(i, dir)
+	}
+	wg.Wait()
+
+	var needsRepair int
+	for i, r := range results {
+		if r.err != nil {
+			log.Warn(r.err)
+			index.putInvalid(dirs[i])
+			continue
+		}
+		if len(r.repairs) > 0 {
+			needsRepair++
+		}
+		backups = append(backups, r.backup)
+		index.put(r.backup)
+	}
+	if needsRepair > 0 {
+		log.Warnf("%d backups have outdated or missing metadata, run 'AtSS repair' to fix them", needsRepair)
+	}
+	return
+}
+
+func reindexBackups() error {
+	unlock, err := lockStore()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	dirs, _ := filepath.Glob(filepath.Join(_backupsDirectory, "Bak.*"))
+	backups, err := rebuildBackupIndex(dirs)
+	if err != nil {
+		return err
+	}
+	log.Infof("indexed %d backups in '%s'", len(backups), _backupsDirectory)
+	return nil
+}
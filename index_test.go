@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// useTestBackupsDirectory points the backups root directory to a temporary
+// directory for the duration of the test.
+func useTestBackupsDirectory(t *testing.T) string {
+	t.Helper()
+	prev := _backupsDirectory
+	_backupsDirectory = t.TempDir()
+	t.Cleanup(func() { _backupsDirectory = prev })
+	return _backupsDirectory
+}
+
+// writeTestBackup writes a backup with a valid save and the given metadata to
+// the backups root directory.
+func writeTestBackup(t *testing.T, dirname string, metadata BackupMetadata) Backup {
+	t.Helper()
+	dir := filepath.Join(_backupsDirectory, dirname)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestSave(t, dir, true, 1, 0)
+	metadata.SchemaVersion = _metadataSchemaVersion
+	if metadata.Origin == "" {
+		metadata.Origin = _originManual
+	}
+	if err := writeBackupMetadata(metadata, dir); err != nil {
+		t.Fatal(err)
+	}
+	return Backup{Metadata: metadata, Dir: dir}
+}
+
+func TestBackupIndexStaleDirs(t *testing.T) {
+	root := useTestBackupsDirectory(t)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	b1 := writeTestBackup(t, "Bak.2024-01-02_03.04.05", BackupMetadata{CreatedAt: created})
+	b2 := writeTestBackup(t, "Bak.2024-01-02_03.04.06", BackupMetadata{CreatedAt: created.Add(time.Second)})
+	invalid := filepath.Join(root, "Bak.2024-01-02_03.04.07")
+	if err := os.Mkdir(invalid, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dirs := []string{b1.Dir, b2.Dir, invalid}
+
+	tests := []struct {
+		name      string
+		dirs      []string
+		touch     string
+		wantStale []string
+		wantExtra bool
+	}{
+		{"up to date", dirs, "", nil, false},
+		{"new directory", append(slices.Clone(dirs), filepath.Join(root, "Bak.new")), "", []string{filepath.Join(root, "Bak.new")}, false},
+		{"removed directory", []string{b1.Dir, invalid}, "", nil, true},
+		{"metadata rewritten", dirs, b2.Dir, []string{b2.Dir}, false},
+		{"invalid directory got metadata", dirs, invalid, []string{invalid}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, index := loadBackupDirs(dirs)
+			if len(index.Backups) != 2 || len(index.Invalid) != 1 {
+				t.Fatalf("indexed %d backups and %d invalid, want 2 and 1", len(index.Backups), len(index.Invalid))
+			}
+			if tt.touch != "" {
+				file := filepath.Join(tt.touch, _metadataFilename)
+				if err := os.WriteFile(file, []byte("{}"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				later := time.Now().Add(time.Hour)
+				if err := os.Chtimes(file, later, later); err != nil {
+					t.Fatal(err)
+				}
+				if tt.touch == invalid {
+					t.Cleanup(func() { _ = os.Remove(file) })
+				} else {
+					t.Cleanup(func() { _ = writeBackupMetadata(b2.Metadata, b2.Dir) })
+				}
+			}
+			stale, extra := index.staleDirs(tt.dirs)
+			if !slices.Equal(stale, tt.wantStale) || extra != tt.wantExtra {
+				t.Errorf("staleDirs = %q, %t, want %q, %t", stale, extra, tt.wantStale, tt.wantExtra)
+			}
+			if got, want := index.isUpToDate(tt.dirs), len(tt.wantStale) == 0 && !tt.wantExtra; got != want {
+				t.Errorf("isUpToDate = %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestGetBackupsPersistsStaleIndex(t *testing.T) {
+	useTestBackupsDirectory(t)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	writeTestBackup(t, "Bak.2024-01-02_03.04.05", BackupMetadata{CreatedAt: created})
+	writeTestBackup(t, "Bak.2024-01-02_03.04.06", BackupMetadata{CreatedAt: created.Add(time.Second)})
+
+	backups, err := getBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("listed %d backups, want 2", len(backups))
+	}
+	dirs, _ := filepath.Glob(filepath.Join(_backupsDirectory, "Bak.*"))
+	index, err := readBackupIndex()
+	if err != nil {
+		t.Fatalf("index not written: %s", err)
+	}
+	if !index.isUpToDate(dirs) {
+		t.Error("written index is stale")
+	}
+}
+
+func TestUpdateBackupMetadataKeepsConcurrentChanges(t *testing.T) {
+	useTestBackupsDirectory(t)
+	backup := writeTestBackup(t, "Bak.2024-01-02_03.04.05", BackupMetadata{
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	if _, err := getBackups(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both changes start from the same stale copy.
+	if _, err := annotateBackup(backup, "before the storm"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pinBackup(backup, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{"metadata file", "index"} {
+		var metadata BackupMetadata
+		switch source {
+		case "metadata file":
+			b, err := readBackup(backup.Dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metadata = b.Metadata
+		case "index":
+			backups, err := getBackups()
+			if err != nil || len(backups) != 1 {
+				t.Fatalf("getBackups = %d backups, %v", len(backups), err)
+			}
+			metadata = backups[0].Metadata
+		}
+		if metadata.Note != "before the storm" || !metadata.Pinned {
+			t.Errorf("%s: note %q, pinned %t; want both changes kept", source, metadata.Note, metadata.Pinned)
+		}
+	}
+}
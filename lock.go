@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// Lock files in the backups root directory coordinate AtSS instances. A lock is
+// held through an advisory OS lock on its file (LockFileEx on Windows), which
+// the OS releases if the holder dies, so there are no stale locks to take
+// over. Lock files stay in place; their content only describes the holder.
+const (
+	_autosaveLockFilename = "atss-autosave.lock"
+	_storeLockFilename    = "atss-store.lock"
+	// How long to wait for the store lock held by another instance.
+	_storeLockTimeout = 30 * time.Second
+)
+
+var _errLockHeld = errors.New("lock is held by another AtSS instance")
+
+// _storeMu serializes store operations within this process, so that
+// goroutines wait on it instead of polling the store lock.
+var _storeMu sync.Mutex
+
+type lockOwner struct {
+	PID        int       `json:"pid"`
+	Executable string    `json:"executable"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+}
+
+type fileLock struct {
+	path string
+	file *os.File
+}
+
+// tryLock attempts to acquire the named lock once, failing with an error
+// wrapping _errLockHeld if another process holds it.
+func tryLock(name string) (*fileLock, error) {
+	path := filepath.Join(_backupsDirectory, name)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file '%s': %w", path, err)
+	}
+	acquired, err := lockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock '%s': %w", path, err)
+	}
+	if !acquired {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s", _errLockHeld, describeLockHolder(path))
+	}
+	executable, _ := os.Executable()
+	encoded, _ := json.Marshal(lockOwner{
+		PID:        os.Getpid(),
+		Executable: filepath.Base(executable),
+		AcquiredAt: time.Now(),
+	})
+	// The content is informational, so failing to write it is harmless.
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt(encoded, 0)
+	}
+	log.Debugf("acquired lock '%s'", path)
+	return &fileLock{path: path, file: f}, nil
+}
+
+// acquireLock waits up to timeout for the named lock.
+func acquireLock(name string, timeout time.Duration) (*fileLock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := tryLock(name)
+		if err == nil || !errors.Is(err, _errLockHeld) || time.Now().After(deadline) {
+			return lock, err
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// describeLockHolder describes the holder of a lock from its lock file.
+func describeLockHolder(path string) string {
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Sprintf("lock file '%s' unreadable", path)
+	}
+	var owner lockOwner
+	if err := json.Unmarshal(encoded, &owner); err != nil || owner.PID == 0 {
+		// Possibly just acquired, and not written yet.
+		return fmt.Sprintf("holder of '%s' unknown", path)
+	}
+	return fmt.Sprintf("held by %s (PID %d) since %s",
+		owner.Executable, owner.PID, owner.AcquiredAt.Format("2006-01-02 15:04:05"))
+}
+
+func (l *fileLock) release() error {
+	_ = l.file.Truncate(0)
+	unlockErr := unlockFile(l.file)
+	closeErr := l.file.Close()
+	if err := errors.Join(unlockErr, closeErr); err != nil {
+		return fmt.Errorf("failed to release lock '%s': %w", l.path, err)
+	}
+	return nil
+}
+
+// lockStore acquires the store lock for an operation that modifies backups or
+// saves. The returned function releases it.
+func lockStore() (unlock func(), err error) {
+	_storeMu.Lock()
+	lock, err := acquireLock(_storeLockFilename, _storeLockTimeout)
+	if err != nil {
+		_storeMu.Unlock()
+		return nil, fmt.Errorf("failed to lock backups directory: %w", err)
+	}
+	return storeUnlocker(lock), nil
+}
+
+// tryLockStore acquires the store lock only if it's free, for optional work
+// that needn't wait for other operations.
+func tryLockStore() (unlock func(), ok bool) {
+	if !_storeMu.TryLock() {
+		return nil, false
+	}
+	lock, err := tryLock(_storeLockFilename)
+	if err != nil {
+		_storeMu.Unlock()
+		log.Debugf("store lock not acquired: %s", err)
+		return nil, false
+	}
+	return storeUnlocker(lock), true
+}
+
+func storeUnlocker(lock *fileLock) func() {
+	return func() {
+		if err := lock.release(); err != nil {
+			log.Warn(err)
+		}
+		_storeMu.Unlock()
+	}
+}
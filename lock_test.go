@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTryLock(t *testing.T) {
+	useTestBackupsDirectory(t)
+
+	lock, err := tryLock(_autosaveLockFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tryLock(_autosaveLockFilename)
+	if !errors.Is(err, _errLockHeld) {
+		t.Fatalf("second tryLock = %v, want %v", err, _errLockHeld)
+	}
+	if pid := fmt.Sprintf("(PID %d)", os.Getpid()); !strings.Contains(err.Error(), pid) {
+		t.Errorf("error %q doesn't name the holder %s", err, pid)
+	}
+	if _, err := acquireLock(_autosaveLockFilename, 300*time.Millisecond); !errors.Is(err, _errLockHeld) {
+		t.Errorf("acquireLock = %v, want %v after timing out", err, _errLockHeld)
+	}
+	if other, err := tryLock(_storeLockFilename); err != nil {
+		t.Errorf("tryLock of another lock = %v", err)
+	} else if err := other.release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lock.release(); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = tryLock(_autosaveLockFilename)
+	if err != nil {
+		t.Fatalf("tryLock after release = %v", err)
+	}
+	if err := lock.release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTryLockStore(t *testing.T) {
+	useTestBackupsDirectory(t)
+
+	unlock, err := lockStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tryLockStore(); ok {
+		t.Fatal("tryLockStore succeeded while the store is locked")
+	}
+	unlock()
+	unlock, ok := tryLockStore()
+	if !ok {
+		t.Fatal("tryLockStore failed while the store is free")
+	}
+	unlock()
+}
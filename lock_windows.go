@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// The locked byte range is far beyond the content of lock files, so that the
+// content stays readable by other processes while locked.
+const _lockFileRegionOffsetHigh = 0x7fffffff
+
+// lockFile attempts to lock f without waiting, reporting whether it's locked.
+func lockFile(f *os.File) (bool, error) {
+	overlapped := windows.Overlapped{OffsetHigh: _lockFileRegionOffsetHigh}
+	err := windows.LockFileEx(windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockFile(f *os.File) error {
+	overlapped := windows.Overlapped{OffsetHigh: _lockFileRegionOffsetHigh}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &overlapped)
+}
@@ -2,10 +2,13 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"sync"
 
 	"github.com/inconshreveable/mousetrap"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
 )
 
 var log = &logrus.Logger{
@@ -16,9 +19,10 @@ var log = &logrus.Logger{
 }
 
 // Exit is a wrapper around os.Exit that waits for the user to press Enter
-// before exiting if the program was started by Explorer.
+// before exiting if the program was started by Explorer, unless there's no
+// terminal to press Enter in.
 func Exit(code int) {
-	if mousetrap.StartedByExplorer() {
+	if mousetrap.StartedByExplorer() && term.IsTerminal(int(os.Stdin.Fd())) {
 		fmt.Println()
 		fmt.Println("Press Enter to exit...")
 		fmt.Scanln()
@@ -27,8 +31,13 @@ func Exit(code int) {
 }
 
 func Fatal(v ...any) {
+	FatalWithCode(1, v...)
+}
+
+// FatalWithCode is like Fatal, but exits with the given code.
+func FatalWithCode(code int, v ...any) {
 	log.Log(logrus.FatalLevel, v...)
-	Exit(1)
+	Exit(code)
 }
 
 func Fatalf(format string, v ...any) {
@@ -51,6 +60,14 @@ func Warnf(format string, v ...any) {
 	log.Warnf(format, v...)
 }
 
+func Debug(v ...any) {
+	log.Debug(v...)
+}
+
+func Debugf(format string, v ...any) {
+	log.Debugf(format, v...)
+}
+
 func Info(v ...any) {
 	log.Info(v...)
 }
@@ -58,3 +75,111 @@ func Info(v ...any) {
 func Infof(format string, v ...any) {
 	log.Infof(format, v...)
 }
+
+// Fields are structured context attached to a log line.
+type Fields = logrus.Fields
+
+func WithFields(fields Fields) *logrus.Entry {
+	return log.WithFields(fields)
+}
+
+// SetOutput redirects log lines, e.g. while a full-screen UI is displayed.
+func SetOutput(w io.Writer) {
+	log.SetOutput(w)
+}
+
+// SetLevel sets the minimum level of log lines: debug, info, warn or error.
+func SetLevel(name string) error {
+	level, err := logrus.ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+	return nil
+}
+
+// Whether log lines are formatted as JSON, for log collectors, instead of
+// text.
+var jsonFormat bool
+
+// SetFormat sets the format of log lines: text or json.
+func SetFormat(name string) error {
+	switch name {
+	case "text":
+		jsonFormat = false
+		log.SetFormatter(&logrus.TextFormatter{ForceColors: true})
+	case "json":
+		jsonFormat = true
+		log.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format '%s'", name)
+	}
+	return nil
+}
+
+// AddFile appends log lines to the named file as well, in the same format but
+// without colors. Unlike SetOutput, this is not meant to be undone.
+func AddFile(name string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file '%s': %w", name, err)
+	}
+	log.AddHook(&fileHook{file: f})
+	return nil
+}
+
+type fileHook struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (h *fileHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *fileHook) Fire(entry *logrus.Entry) error {
+	var formatter logrus.Formatter = &logrus.TextFormatter{DisableColors: true, FullTimestamp: true}
+	if jsonFormat {
+		formatter = &logrus.JSONFormatter{}
+	}
+	line, err := formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = h.file.Write(line)
+	return err
+}
+
+// warningRecorder records warning messages, for inclusion in machine-readable
+// command results.
+type warningRecorder struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+var recorder = &warningRecorder{}
+
+func (r *warningRecorder) Levels() []logrus.Level {
+	return []logrus.Level{logrus.WarnLevel}
+}
+
+func (r *warningRecorder) Fire(entry *logrus.Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, entry.Message)
+	return nil
+}
+
+// RecordWarnings starts recording warning messages, retrieved with Warnings.
+// Only meant for short-lived commands, as messages are kept indefinitely.
+func RecordWarnings() {
+	log.AddHook(recorder)
+}
+
+func Warnings() []string {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	return append([]string(nil), recorder.messages...)
+}
@@ -1,60 +1,68 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/charmbracelet/huh"
 	"github.com/spf13/cobra"
 
 	"github.com/fanaticscripter/AtSS/log"
 )
 
+var (
+	_rootCmdVerbose   bool
+	_rootCmdQuiet     bool
+	_rootCmdLogLevel  string
+	_rootCmdLogFormat string
+	_rootCmdLogFile   string
+)
+
 var _rootCmd = &cobra.Command{
 	Use:   "AtSS",
 	Short: "Against the Storm Save Scummer",
 	Args:  cobra.NoArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		var action string
-		// Use reverse on the selected option, since the default highlight color
-		// is overridden.
-		theme := huh.ThemeCharm()
-		theme.Focused.SelectedOption.Reverse(true)
-		form := huh.NewForm(
-			huh.NewGroup(
-				huh.NewSelect[string]().
-					Title("Choose an action").
-					Options(
-						huh.NewOption(colored(_green, "Save current state"), "save"),
-						huh.NewOption(colored(_green, "Save current and future states automatically"), "autosave"),
-						huh.NewOption(colored(_blue, "Restore previously saved state"), "restore"),
-						huh.NewOption(colored(_red, "Delete previously saved states"), "delete"),
-						huh.NewOption(colored(_yellow, "Open saves directory"), "open"),
-					).
-					Value(&action),
-			),
-		).WithTheme(theme)
-		if err := form.Run(); err != nil {
-			log.Fatal(err)
-		}
-		switch action {
-		case "save":
-			if err := createBackupInteractive(); err != nil {
-				log.Fatal(err)
-			}
-		case "autosave":
-			startAutoBackups()
-		case "restore":
-			if err := restoreBackupInteractive(); err != nil {
-				log.Fatal(err)
+	// Command line errors are reported by main.
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		level := _rootCmdLogLevel
+		if _rootCmdVerbose {
+			level = "debug"
+		} else if _rootCmdQuiet {
+			level = "warn"
+		}
+		if err := log.SetLevel(level); err != nil {
+			return fmt.Errorf("%w: %w", _errUsage, err)
+		}
+		if err := log.SetFormat(_rootCmdLogFormat); err != nil {
+			return fmt.Errorf("%w: %w", _errUsage, err)
+		}
+		if _rootCmdLogFile != "" {
+			if err := log.AddFile(_rootCmdLogFile); err != nil {
+				return err
 			}
-			log.Exit(0)
-		case "delete":
-			if err := deleteBackupsInteractive(); err != nil {
-				log.Fatal(err)
+		}
+		switch _outputFormat {
+		case _outputText:
+		case _outputJSON:
+			if cmd != _autoSaveCmd && cmd != _serveCmd {
+				log.RecordWarnings()
 			}
-			log.Exit(0)
-		case "open":
-			openSavesDirectory()
+		default:
+			return fmt.Errorf("%w: unknown output format '%s'", _errUsage, _outputFormat)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		requireInteractive("a subcommand is required")
+		if err := runApp(); err != nil {
+			fail(err)
 		}
 	},
 }
@@ -67,56 +75,288 @@ var _saveCmd = &cobra.Command{
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		noteFlag := cmd.Flags().Lookup("note")
-		if noteFlag.Changed {
-			// --note flag is set, activate non-interactive mode.
+		if noteFlag.Changed || jsonOutput() || !isInteractive() {
+			// --note flag is set or prompting is impossible, activate
+			// non-interactive mode.
 			backup, err := createBackup(BackupMetadata{
 				Note: _saveCmdNote,
 			})
 			if err != nil {
-				log.Fatal(err)
+				fail(err)
 			}
-			log.Infof("created backup %s", backup.Dir)
+			result := newAPIBackup(backup)
+			succeed(commandResult{Backup: &result}, func() {
+				log.Infof("created backup %s", backup.Dir)
+			})
 		} else {
 			if err := createBackupInteractive(); err != nil {
-				log.Fatal(err)
+				fail(err)
 			}
 		}
 	},
 }
 
+var (
+	_autoSaveCmdTriggers    []string
+	_autoSaveCmdEveryN      int
+	_autoSaveCmdHeadless    bool
+	_autoSaveCmdDebounce    time.Duration
+	_autoSaveCmdMaxWait     time.Duration
+	_autoSaveCmdStableFor   time.Duration
+	_autoSaveCmdMinInterval time.Duration
+	_autoSaveCmdMaxPerHour  int
+	_autoSaveCmdInterval    time.Duration
+)
+
 var _autoSaveCmd = &cobra.Command{
 	Use:   "autosave",
 	Short: "Save current and future states automatically",
+	Long:  "Save current and future states automatically. While autosave is running, it can be controlled from other invocations with the subcommands.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		options := loadAutoBackupOptions()
+		if cmd.Flags().Changed("trigger") {
+			options.Triggers = _autoSaveCmdTriggers
+		}
+		if cmd.Flags().Changed("every") {
+			options.EveryN = _autoSaveCmdEveryN
+		}
+		if cmd.Flags().Changed("debounce") {
+			options.Debounce = _autoSaveCmdDebounce
+		}
+		if cmd.Flags().Changed("max-wait") {
+			options.MaxWait = _autoSaveCmdMaxWait
+		}
+		if cmd.Flags().Changed("stable-for") {
+			options.StableFor = _autoSaveCmdStableFor
+		}
+		if cmd.Flags().Changed("min-interval") {
+			options.MinInterval = _autoSaveCmdMinInterval
+		}
+		if cmd.Flags().Changed("max-per-hour") {
+			options.MaxPerHour = _autoSaveCmdMaxPerHour
+		}
+		if cmd.Flags().Changed("interval") {
+			options.Interval = _autoSaveCmdInterval
+		}
+		// Reports are printed as JSON lines, which the TUI would garble, and
+		// the TUI needs a terminal anyway.
+		options.Headless = _autoSaveCmdHeadless || jsonOutput() || !isInteractive()
+		startAutoBackups(options)
+	},
+}
+
+var _autoSaveStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of the running autosave",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var status autosaveStatus
+		if err := callAutosave(http.MethodGet, "/status", nil, &status); err != nil {
+			fail(err)
+		}
+		succeed(commandResult{Autosave: &status}, func() {
+			printAutosaveStatus(status)
+		})
+	},
+}
+
+var _autoSavePauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause the running autosave, ignoring save updates until resumed",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var status autosaveStatus
+		if err := callAutosave(http.MethodPost, "/pause", nil, &status); err != nil {
+			fail(err)
+		}
+		succeed(commandResult{Autosave: &status}, func() {
+			log.Info("autosave paused")
+		})
+	},
+}
+
+var _autoSaveResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume the paused autosave",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var status autosaveStatus
+		if err := callAutosave(http.MethodPost, "/resume", nil, &status); err != nil {
+			fail(err)
+		}
+		succeed(commandResult{Autosave: &status}, func() {
+			log.Info("autosave resumed")
+		})
+	},
+}
+
+var _autoSaveTriggerCmdNote string
+
+var _autoSaveTriggerCmd = &cobra.Command{
+	Use:   "trigger",
+	Short: "Make the running autosave back up immediately",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var backup apiBackup
+		if err := callAutosave(http.MethodPost, "/trigger", autosaveTriggerRequest{Note: _autoSaveTriggerCmdNote}, &backup); err != nil {
+			fail(err)
+		}
+		succeed(commandResult{Backup: &backup}, func() {
+			log.Infof("created backup %s", backup.Dir)
+		})
+	},
+}
+
+var _autoSaveStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the running autosave",
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		startAutoBackups()
+		if err := callAutosave(http.MethodPost, "/stop", nil, nil); err != nil {
+			fail(err)
+		}
+		succeed(commandResult{}, func() {
+			log.Info("autosave stopped")
+		})
+	},
+}
+
+var _autoSaveServiceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Generate a service definition to run headless autosave at login",
+	Long:  "Generate a scheduled task command to run headless autosave at login. Autosave options are read from the config file.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		requireText("service definitions are only printed as text")
+		definition, instructions, err := serviceDefinition()
+		if err != nil {
+			fail(err)
+		}
+		fmt.Print(definition)
+		log.Info(instructions)
 	},
 }
 
+// loadAutoBackupOptions loads autosave options from the config file, to be
+// overridden by command line flags.
+func loadAutoBackupOptions() autoBackupOptions {
+	config, err := getConfig()
+	if err != nil {
+		fail(err)
+	}
+	options := autoBackupOptions{
+		Triggers:   config.Autosave.Triggers,
+		EveryN:     config.Autosave.EveryN,
+		MaxPerHour: config.Autosave.MaxPerHour,
+	}
+	for _, setting := range []struct {
+		name         string
+		value        string
+		defaultValue time.Duration
+		d            *time.Duration
+	}{
+		{"autosave.debounce", config.Autosave.Debounce, _defaultAutoBackupDebounce, &options.Debounce},
+		{"autosave.maxWait", config.Autosave.MaxWait, _defaultAutoBackupMaxWait, &options.MaxWait},
+		{"autosave.stableFor", config.Autosave.StableFor, 0, &options.StableFor},
+		{"autosave.minInterval", config.Autosave.MinInterval, 0, &options.MinInterval},
+		{"autosave.interval", config.Autosave.Interval, 0, &options.Interval},
+	} {
+		if *setting.d, err = parseDuration(setting.name, setting.value, setting.defaultValue); err != nil {
+			fail(err)
+		}
+	}
+	return options
+}
+
+var (
+	_restoreCmdFiles          []string
+	_restoreCmdSettlementOnly bool
+	_restoreCmdWait           bool
+	_restoreCmdForce          bool
+)
+
 var _restoreCmd = &cobra.Command{
-	Use:   "restore",
+	Use:   "restore [backup]",
 	Short: "Restore a previously saved state",
-	Args:  cobra.NoArgs,
+	Long:  "Restore a previously saved state. If a backup is given by its directory name, e.g. Bak.2006-01-02_15.04.05, it is restored non-interactively.",
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := restoreBackupInteractive(); err != nil {
-			log.Fatal(err)
+		scope := restoreScope{
+			Files:          _restoreCmdFiles,
+			SettlementOnly: _restoreCmdSettlementOnly,
+		}
+		if len(args) > 0 {
+			backup, err := findBackup(args[0])
+			if err != nil {
+				fail(err)
+			}
+			watch := newExitSaveWatch()
+			autoBackup, err := restoreBackup(backup, scope)
+			if errors.Is(err, _errGameIsRunningRestoreRefused) && _restoreCmdWait {
+				log.Info("waiting for the game to exit")
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+				defer stop()
+				autoBackup, err = restoreBackupAfterGameExit(ctx, backup, scope, watch, func() bool { return _restoreCmdForce })
+			}
+			if err != nil {
+				fail(err)
+			}
+			restored := newAPIBackup(backup)
+			result := commandResult{Backup: &restored}
+			if autoBackup.Dir != "" {
+				overwritten := newAPIBackup(autoBackup)
+				result.OverwrittenBackup = &overwritten
+			}
+			succeed(result, func() {})
+		} else {
+			requireInteractive("give the backup to restore by its directory name (see 'AtSS list'), optionally with --files, --settlement-only, or --wait and --force")
+			if err := restoreBackupInteractive(scope); err != nil {
+				fail(err)
+			}
 		}
 		log.Exit(0)
 	},
 }
 
 var _deleteCmd = &cobra.Command{
-	Use:   "delete",
+	Use:   "delete [backup]...",
 	Short: "Delete previsouly saved states",
-	Args:  cobra.NoArgs,
+	Long:  "Delete previously saved states. If backups are given by their directory names, e.g. Bak.2006-01-02_15.04.05, they are deleted non-interactively.",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := deleteBackupsInteractive(); err != nil {
-			log.Fatal(err)
+		if len(args) > 0 {
+			deleted, err := deleteBackups(args)
+			if err != nil {
+				fail(err)
+			}
+			succeed(commandResult{Backups: newAPIBackups(deleted)}, func() {})
+		} else {
+			requireInteractive("give the backups to delete by their directory names (see 'AtSS list')")
+			if err := deleteBackupsInteractive(); err != nil {
+				fail(err)
+			}
 		}
 		log.Exit(0)
 	},
 }
 
+var _listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved states",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		backups, err := getBackups()
+		if err != nil {
+			fail(err)
+		}
+		succeed(commandResult{Backups: newAPIBackups(backups)}, func() {
+			for _, b := range backups {
+				fmt.Printf("%s  %s\n", filepath.Base(b.Dir), b)
+			}
+		})
+	},
+}
+
 var _openCmd = &cobra.Command{
 	Use:   "open",
 	Short: "Open the saves directory",
@@ -126,6 +366,80 @@ var _openCmd = &cobra.Command{
 	},
 }
 
+var _reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Rebuild the index of saved states",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := reindexBackups(); err != nil {
+			fail(err)
+		}
+		succeed(commandResult{}, func() {})
+	},
+}
+
+var _verifyCmd = &cobra.Command{
+	Use:   "verify [backup]...",
+	Short: "Verify saved states against their file manifests",
+	Long:  "Verify saved states against their file manifests. Backups are identified by their directory names, e.g. Bak.2006-01-02_15.04.05; all backups are verified if none is given.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := verifyBackups(args); err != nil {
+			fail(err)
+		}
+		succeed(commandResult{}, func() {})
+	},
+}
+
+var _diffCmd = &cobra.Command{
+	Use:   "diff [backup]",
+	Short: "Compare a saved state with the current state",
+	Long:  "Compare a saved state with the current state file by file. The backup is identified by its directory name, e.g. Bak.2006-01-02_15.04.05, and chosen interactively if not given.",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireText("diffs are only printed as text")
+		var id string
+		if len(args) > 0 {
+			id = args[0]
+		} else {
+			requireInteractive("give the backup to compare by its directory name (see 'AtSS list')")
+		}
+		if err := diffBackup(id); err != nil {
+			fail(err)
+		}
+	},
+}
+
+var (
+	_serveCmdAddr  string
+	_serveCmdToken string
+)
+
+var _serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a local HTTP API and web UI",
+	Long:  "Serve a local HTTP JSON API and web UI for managing saved states, e.g. from a phone on the LAN. Binds to localhost by default; a token is required to bind to other addresses.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := serveAPI(_serveCmdAddr, _serveCmdToken); err != nil {
+			fail(err)
+		}
+	},
+}
+
+var _repairCmdDryRun bool
+
+var _repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Back-fill and fix metadata of saved states",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := repairBackups(_repairCmdDryRun); err != nil {
+			fail(err)
+		}
+		succeed(commandResult{}, func() {})
+	},
+}
+
 func init() {
 	// Allow program to be launched from explorer.exe directly, instead of being
 	// trapped by cobra.
@@ -134,10 +448,38 @@ func init() {
 
 func main() {
 	_saveCmd.Flags().StringVarP(&_saveCmdNote, "note", "n", "", "note to attach to the save, may be empty; the save is created non-interactively if this flag is set")
-	_rootCmd.AddCommand(_saveCmd, _autoSaveCmd, _restoreCmd, _deleteCmd, _openCmd)
+	_autoSaveCmd.Flags().StringSliceVarP(&_autoSaveCmdTriggers, "trigger", "t", nil, "only back up when one of these trigger policies fires: "+strings.Join(autoBackupPolicyNames(), ", ")+" (default always)")
+	_autoSaveCmd.Flags().IntVar(&_autoSaveCmdEveryN, "every", 0, "N for the every-n trigger policy, i.e. back up every Nth save update")
+	_autoSaveTriggerCmd.Flags().StringVarP(&_autoSaveTriggerCmdNote, "note", "n", "", "note to attach to the backup (default: description of events since the last backup)")
+	_autoSaveCmd.Flags().DurationVar(&_autoSaveCmdDebounce, "debounce", _defaultAutoBackupDebounce, "wait for save updates to settle for this long before processing them")
+	_autoSaveCmd.Flags().DurationVar(&_autoSaveCmdMaxWait, "max-wait", _defaultAutoBackupMaxWait, "process save updates after at most this long, even if they haven't settled; 0 for no limit")
+	_autoSaveCmd.Flags().DurationVar(&_autoSaveCmdStableFor, "stable-for", 0, "instead of debouncing, wait until all save files have had unchanged sizes and modification times for this long")
+	_autoSaveCmd.Flags().DurationVar(&_autoSaveCmdMinInterval, "min-interval", 0, "minimum time between automatic backups; updates in between are backed up once allowed")
+	_autoSaveCmd.Flags().IntVar(&_autoSaveCmdMaxPerHour, "max-per-hour", 0, "maximum number of automatic backups per hour, 0 for no limit")
+	_autoSaveCmd.Flags().DurationVar(&_autoSaveCmdInterval, "interval", 0, "also take a snapshot on this interval while the game is running, e.g. 10m, unless the save is unchanged; 0 to disable")
+	_autoSaveCmd.Flags().BoolVar(&_autoSaveCmdHeadless, "headless", false, "run without the interactive display, logging to stderr; for running as a service (see 'autosave service')")
+	_autoSaveCmd.AddCommand(_autoSaveStatusCmd, _autoSavePauseCmd, _autoSaveResumeCmd, _autoSaveTriggerCmd, _autoSaveStopCmd, _autoSaveServiceCmd)
+	_restoreCmd.Flags().StringSliceVarP(&_restoreCmdFiles, "files", "f", nil, "restore only these save files (e.g. Save.save,Profiles.save) instead of all; an auto backup of all current save files is still created")
+	_restoreCmd.Flags().BoolVar(&_restoreCmdSettlementOnly, "settlement-only", false, "restore only the settlement state, keeping the current meta-progression (upgrades, resources, unlocked buildings)")
+	_restoreCmd.Flags().BoolVar(&_restoreCmdWait, "wait", false, "if the game needs to exit first, wait for it and restore then, unless you keep playing and the save changes meanwhile (see --force); the save written on exit is backed up as Bak.overwritten and replaced. Only applies when a backup is given")
+	_restoreCmd.Flags().BoolVar(&_restoreCmdForce, "force", false, "with --wait, restore even if the save changed while playing; the changed save is still backed up first as Bak.overwritten")
+	_restoreCmd.MarkFlagsMutuallyExclusive("files", "settlement-only")
+	_serveCmd.Flags().StringVar(&_serveCmdAddr, "addr", _defaultServeAddr, "address to listen on, e.g. 0.0.0.0:8734 for LAN access")
+	_serveCmd.Flags().StringVar(&_serveCmdToken, "token", "", "token required in API requests (as a bearer token or ?token= query parameter); open the web UI with ?token=<token> once")
+	_repairCmd.Flags().BoolVar(&_repairCmdDryRun, "dry-run", false, "only report the changes that would be made")
+	_rootCmd.PersistentFlags().StringVarP(&_outputFormat, "output", "o", _outputText, "output format of command results: text, or json for scripts (implies non-interactive mode)")
+	_rootCmd.PersistentFlags().BoolVarP(&_rootCmdVerbose, "verbose", "v", false, "log debug messages too, same as --log-level debug")
+	_rootCmd.PersistentFlags().BoolVarP(&_rootCmdQuiet, "quiet", "q", false, "only log warnings and errors, same as --log-level warn")
+	_rootCmd.PersistentFlags().StringVar(&_rootCmdLogLevel, "log-level", "info", "minimum level of log messages: debug, info, warn or error")
+	_rootCmd.PersistentFlags().StringVar(&_rootCmdLogFormat, "log-format", "text", "format of log messages: text, or json for log collectors")
+	_rootCmd.PersistentFlags().StringVar(&_rootCmdLogFile, "log-file", "", "also append log messages to this file, without colors")
+	_rootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet", "log-level")
+	_rootCmd.AddCommand(_saveCmd, _autoSaveCmd, _restoreCmd, _deleteCmd, _listCmd, _openCmd, _verifyCmd, _diffCmd, _serveCmd, _reindexCmd, _repairCmd)
 
 	if err := _rootCmd.Execute(); err != nil {
-		log.Error(err)
-		os.Exit(1)
+		if !errors.Is(err, _errUsage) {
+			err = fmt.Errorf("%w: %w", _errUsage, err)
+		}
+		fail(err)
 	}
 }
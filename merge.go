@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type mergeSource int
+
+const (
+	_fromBackup mergeSource = iota
+	_fromCurrent
+)
+
+func (s mergeSource) String() string {
+	if s == _fromBackup {
+		return "backup"
+	}
+	return "current"
+}
+
+// mergeRule takes the value at a dot-separated JSON path from the given side.
+type mergeRule struct {
+	Path string
+	From mergeSource
+}
+
+// saveFileMergeSpec declares how a save file is assembled when merging a
+// backup with the current save: everything comes from Base, except paths
+// covered by Rules. Save files without a spec are left as is.
+type saveFileMergeSpec struct {
+	File  string
+	Base  mergeSource
+	Rules []mergeRule
+}
+
+// _settlementOnlyMergeSpecs restores the settlement state from a backup, while
+// keeping the meta-progression (upgrades, resources, unlocked buildings, etc.)
+// in the current MetaSave.save. The world map is left alone.
+var _settlementOnlyMergeSpecs = []saveFileMergeSpec{
+	{File: "Save.save", Base: _fromBackup},
+	{
+		File: "MetaSave.save",
+		Base: _fromCurrent,
+		Rules: []mergeRule{
+			{Path: "gameplay.hasActiveGame", From: _fromBackup},
+		},
+	},
+}
+
+// mergePreview shows the values involved in a single merge rule.
+type mergePreview struct {
+	File    string
+	Rule    mergeRule
+	Backup  string
+	Current string
+	Merged  string
+}
+
+func (p mergePreview) String() string {
+	return fmt.Sprintf("%s %s (from %s): current %s, backup %s, merged %s",
+		p.File, p.Rule.Path, p.Rule.From, p.Current, p.Backup, p.Merged)
+}
+
+// mergeSaveFiles assembles save files according to specs from backupDir and
+// currentDir, writing the results to outDir.
+func mergeSaveFiles(specs []saveFileMergeSpec, backupDir, currentDir, outDir string) (previews []mergePreview, err error) {
+	for _, spec := range specs {
+		var filePreviews []mergePreview
+		filePreviews, err = mergeSaveFile(spec, backupDir, currentDir, outDir)
+		if err != nil {
+			err = fmt.Errorf("failed to merge '%s': %w", spec.File, err)
+			return
+		}
+		previews = append(previews, filePreviews...)
+	}
+	return
+}
+
+func mergeSaveFile(spec saveFileMergeSpec, backupDir, currentDir, outDir string) (previews []mergePreview, err error) {
+	sourceDirs := map[mergeSource]string{_fromBackup: backupDir, _fromCurrent: currentDir}
+	out := filepath.Join(outDir, spec.File)
+	if len(spec.Rules) == 0 {
+		err = copyFile(filepath.Join(sourceDirs[spec.Base], spec.File), out)
+		return
+	}
+
+	docs := make(map[mergeSource][]byte)
+	for source, dir := range sourceDirs {
+		if docs[source], err = readJSONDocument(filepath.Join(dir, spec.File)); err != nil {
+			return
+		}
+	}
+	// Values are spliced into the base document as encoded, so that the rest
+	// of it stays byte for byte as the game wrote it.
+	merged := docs[spec.Base]
+	for _, rule := range spec.Rules {
+		keys := strings.Split(rule.Path, ".")
+		value, ok, getErr := jsonPathGet(docs[rule.From], keys)
+		if getErr != nil {
+			err = fmt.Errorf("failed to get '%s' from %s: %w", rule.Path, rule.From, getErr)
+			return
+		}
+		if merged, err = jsonPathSet(merged, keys, value, ok); err != nil {
+			err = fmt.Errorf("failed to set '%s': %w", rule.Path, err)
+			return
+		}
+		previews = append(previews, mergePreview{
+			File:    spec.File,
+			Rule:    rule,
+			Backup:  previewJSONPath(docs[_fromBackup], keys),
+			Current: previewJSONPath(docs[_fromCurrent], keys),
+			Merged:  previewJSONPath(merged, keys),
+		})
+	}
+
+	if err = os.WriteFile(out, merged, 0o644); err != nil {
+		err = fmt.Errorf("failed to write '%s': %w", out, err)
+	}
+	return
+}
+
+func readJSONDocument(path string) (doc []byte, err error) {
+	doc, err = os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("failed to read '%s': %w", path, err)
+		return
+	}
+	if _, _, scanErr := scanJSONObject(doc); scanErr != nil {
+		err = fmt.Errorf("failed to parse '%s': %w", path, scanErr)
+	}
+	return
+}
+
+var _errNotJSONObject = errors.New("not a JSON object")
+
+// jsonMember locates a member of an encoded JSON object by byte offsets.
+type jsonMember struct {
+	key string
+	// Offset right after the opening brace or the previous member, i.e. where
+	// the separator before the member starts.
+	start int
+	value int // Offset of the value
+	end   int // Offset right after the value
+}
+
+// scanJSONObject locates the members of an encoded JSON object, and its
+// closing brace.
+func scanJSONObject(doc []byte) (members []jsonMember, closing int, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	token, err := decoder.Token()
+	if err != nil {
+		return
+	}
+	if token != json.Delim('{') {
+		err = _errNotJSONObject
+		return
+	}
+	start := int(decoder.InputOffset())
+	for decoder.More() {
+		if token, err = decoder.Token(); err != nil {
+			return
+		}
+		var value json.RawMessage
+		if err = decoder.Decode(&value); err != nil {
+			return
+		}
+		end := int(decoder.InputOffset())
+		members = append(members, jsonMember{key: token.(string), start: start, value: end - len(value), end: end})
+		start = end
+	}
+	if _, err = decoder.Token(); err != nil {
+		return
+	}
+	closing = int(decoder.InputOffset()) - 1
+	if _, trailingErr := decoder.Token(); trailingErr != io.EOF {
+		err = errors.New("unexpected content after the top-level object")
+	}
+	return
+}
+
+// findJSONMember returns the index of the member with the given key, the last
+// one if duplicated as that's the one decoders keep, or -1 if there's none.
+func findJSONMember(members []jsonMember, key string) int {
+	for i := len(members) - 1; i >= 0; i-- {
+		if members[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func spliceBytes(doc []byte, start, end int, replacement []byte) []byte {
+	spliced := make([]byte, 0, len(doc)-(end-start)+len(replacement))
+	spliced = append(spliced, doc[:start]...)
+	spliced = append(spliced, replacement...)
+	return append(spliced, doc[end:]...)
+}
+
+// jsonPathGet returns the encoded value at the given keys in an encoded JSON
+// object, with ok false if there's none.
+func jsonPathGet(doc []byte, keys []string) (value []byte, ok bool, err error) {
+	value = doc
+	for i, k := range keys {
+		var members []jsonMember
+		members, _, err = scanJSONObject(value)
+		if errors.Is(err, _errNotJSONObject) && i > 0 {
+			return nil, false, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+		j := findJSONMember(members, k)
+		if j < 0 {
+			return nil, false, nil
+		}
+		value = value[members[j].value:members[j].end]
+	}
+	return value, true, nil
+}
+
+// jsonPathSet returns a copy of an encoded JSON object with the value at the
+// given keys replaced by the encoded value, or deleted if !ok, creating
+// missing parent objects. Everything else is kept byte for byte.
+func jsonPathSet(doc []byte, keys []string, value []byte, ok bool) ([]byte, error) {
+	return jsonPathSetFrom(doc, keys, 0, value, ok)
+}
+
+// jsonPathSetFrom is jsonPathSet for keys[depth:] in doc, the object at
+// keys[:depth].
+func jsonPathSetFrom(doc []byte, keys []string, depth int, value []byte, ok bool) ([]byte, error) {
+	members, closing, err := scanJSONObject(doc)
+	if errors.Is(err, _errNotJSONObject) && depth > 0 {
+		return nil, fmt.Errorf("'%s' is not an object", strings.Join(keys[:depth], "."))
+	} else if err != nil {
+		return nil, err
+	}
+	i := findJSONMember(members, keys[depth])
+	if depth < len(keys)-1 {
+		if i >= 0 {
+			m := members[i]
+			child, err := jsonPathSetFrom(doc[m.value:m.end], keys, depth+1, value, ok)
+			if err != nil {
+				return nil, err
+			}
+			return spliceBytes(doc, m.value, m.end, child), nil
+		}
+		if !ok {
+			return doc, nil
+		}
+		for j := len(keys) - 1; j > depth; j-- {
+			value = append(append([]byte("{"), encodeJSONMember(keys[j], value)...), '}')
+		}
+	}
+	switch {
+	case i >= 0 && ok:
+		return spliceBytes(doc, members[i].value, members[i].end, value), nil
+	case i >= 0:
+		// Remove the member along with the separator before it, or after it
+		// if it's the first one.
+		start, end := members[i].start, members[i].end
+		if i == 0 && len(members) > 1 {
+			end = members[1].start + bytes.IndexByte(doc[members[1].start:], ',') + 1
+		}
+		return spliceBytes(doc, start, end, nil), nil
+	case ok:
+		member := encodeJSONMember(keys[depth], value)
+		if len(members) == 0 {
+			return spliceBytes(doc, closing, closing, member), nil
+		}
+		last := members[len(members)-1].end
+		return spliceBytes(doc, last, last, append([]byte(","), member...)), nil
+	default:
+		return doc, nil
+	}
+}
+
+// encodeJSONMember encodes "key":value, not escaping HTML characters in the
+// key, unlike json.Marshal.
+func encodeJSONMember(key string, value []byte) []byte {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(key)
+	member := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	member = append(member, ':')
+	return append(member, value...)
+}
+
+func previewJSONPath(doc []byte, keys []string) string {
+	value, ok, err := jsonPathGet(doc, keys)
+	if err != nil {
+		return "<unparsable>"
+	}
+	return previewJSONValue(value, ok)
+}
+
+func previewJSONValue(value []byte, ok bool) string {
+	if !ok {
+		return "<missing>"
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, value); err != nil {
+		return "<unparsable>"
+	}
+	s := compact.String()
+	if len(s) > 60 {
+		s = s[:57] + "..."
+	}
+	return s
+}
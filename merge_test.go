@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeSaveFilesSettlementOnly(t *testing.T) {
+	tests := []struct {
+		name         string
+		backupMeta   string
+		currentMeta  string
+		wantMeta     string
+		wantPreviews []string
+	}{
+		{
+			name:        "active game is taken from backup",
+			backupMeta:  `{"gameplay":{"hasActiveGame":true},"level":1}`,
+			currentMeta: `{"gameplay":{"hasActiveGame":false,"xp":12345678901234567890},"level":7}`,
+			wantMeta:    `{"gameplay":{"hasActiveGame":true,"xp":12345678901234567890},"level":7}`,
+			wantPreviews: []string{
+				"MetaSave.save gameplay.hasActiveGame (from backup): current false, backup true, merged true",
+			},
+		},
+		{
+			name:        "rest of the current file is kept byte for byte",
+			backupMeta:  `{"gameplay":{"hasActiveGame":true}}`,
+			currentMeta: "{\"note\": \"<a&b>\",\n \"gameplay\": {\"z\": 1, \"hasActiveGame\": false, \"a\": 2.50}}\n",
+			wantMeta:    "{\"note\": \"<a&b>\",\n \"gameplay\": {\"z\": 1, \"hasActiveGame\": true, \"a\": 2.50}}\n",
+			wantPreviews: []string{
+				"MetaSave.save gameplay.hasActiveGame (from backup): current false, backup true, merged true",
+			},
+		},
+		{
+			name:        "missing in backup is deleted",
+			backupMeta:  `{"gameplay":{}}`,
+			currentMeta: `{"gameplay":{"hasActiveGame":true}}`,
+			wantMeta:    `{"gameplay":{}}`,
+			wantPreviews: []string{
+				"MetaSave.save gameplay.hasActiveGame (from backup): current true, backup <missing>, merged <missing>",
+			},
+		},
+		{
+			name:        "missing parent in current is created",
+			backupMeta:  `{"gameplay":{"hasActiveGame":false}}`,
+			currentMeta: `{}`,
+			wantMeta:    `{"gameplay":{"hasActiveGame":false}}`,
+			wantPreviews: []string{
+				"MetaSave.save gameplay.hasActiveGame (from backup): current <missing>, backup false, merged false",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backupDir, currentDir, outDir := t.TempDir(), t.TempDir(), t.TempDir()
+			writeTestFile(t, filepath.Join(backupDir, "MetaSave.save"), tt.backupMeta)
+			writeTestFile(t, filepath.Join(backupDir, "Save.save"), `{"from":"backup"}`)
+			writeTestFile(t, filepath.Join(currentDir, "MetaSave.save"), tt.currentMeta)
+			writeTestFile(t, filepath.Join(currentDir, "Save.save"), `{"from":"current"}`)
+
+			previews, err := mergeSaveFiles(_settlementOnlyMergeSpecs, backupDir, currentDir, outDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readTestFile(t, filepath.Join(outDir, "Save.save")); got != `{"from":"backup"}` {
+				t.Errorf("Save.save = %s, want the backup copy", got)
+			}
+			if got := readTestFile(t, filepath.Join(outDir, "MetaSave.save")); got != tt.wantMeta {
+				t.Errorf("MetaSave.save = %s, want %s", got, tt.wantMeta)
+			}
+			if len(previews) != len(tt.wantPreviews) {
+				t.Fatalf("got %d previews, want %d", len(previews), len(tt.wantPreviews))
+			}
+			for i, p := range previews {
+				if p.String() != tt.wantPreviews[i] {
+					t.Errorf("preview = %q, want %q", p, tt.wantPreviews[i])
+				}
+			}
+		})
+	}
+}
+
+func TestJSONPathSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		path    string
+		value   string // Deleted if empty
+		want    string
+		wantErr bool
+	}{
+		{"replace nested", `{"b":1, "a":{"y":"<&>","x":false}}`, "a.x", "true", `{"b":1, "a":{"y":"<&>","x":true}}`, false},
+		{"replace keeps formatting", "{\n  \"a\": {\n    \"x\": 1\n  }\n}\n", "a.x", "2", "{\n  \"a\": {\n    \"x\": 2\n  }\n}\n", false},
+		{"replace duplicate key uses last", `{"a":1,"a":2}`, "a", "3", `{"a":1,"a":3}`, false},
+		{"add to object", `{"a":{"x":1}}`, "a.y", `"<b>"`, `{"a":{"x":1,"y":"<b>"}}`, false},
+		{"add to empty object", `{"a":{ }}`, "a.y", "1", `{"a":{ "y":1}}`, false},
+		{"add missing parents", `{"z":0}`, "a.b.c", "1", `{"z":0,"a":{"b":{"c":1}}}`, false},
+		{"delete middle", `{"a":1, "b":2, "c":3}`, "b", "", `{"a":1, "c":3}`, false},
+		{"delete first", `{"a":1, "b":2}`, "a", "", `{ "b":2}`, false},
+		{"delete only", `{"a":{"x":1}}`, "a.x", "", `{"a":{}}`, false},
+		{"delete missing", `{"a":1}`, "b.c", "", `{"a":1}`, false},
+		{"set under non-object", `{"a":"flat"}`, "a.x", "1", "", true},
+		{"not an object", `[1]`, "a", "1", "", true},
+		{"trailing content", `{"a":1} {}`, "a", "2", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jsonPathSet([]byte(tt.doc), strings.Split(tt.path, "."), []byte(tt.value), tt.value != "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// _metadataSchemaVersion is the version of the backup metadata schema
+// understood by this binary. Bump it whenever a migration is added to
+// _metadataMigrations.
+const _metadataSchemaVersion = 3
+
+var (
+	_errMetadataFromNewerSchema = errors.New("backup metadata is from a newer version of AtSS")
+	_errMetadataMigrationFailed = errors.New("failed to migrate backup metadata")
+)
+
+// metadataMigration upgrades decoded metadata fields from schema version to-1
+// to schema version to. dir is the backup directory, which may be consulted to
+// back-fill new fields. migrate returns a human readable description of each
+// change made.
+type metadataMigration struct {
+	to          int
+	description string
+	migrate     func(dir string, fields map[string]json.RawMessage) (changes []string, err error)
+}
+
+// Migrations must be ordered by target version, with no gaps.
+var _metadataMigrations = []metadataMigration{
+	{
+		to:          1,
+		description: "back-fill save hash and season",
+		migrate:     migrateMetadataBackfillHashAndSeason,
+	},
+	{
+		to:          2,
+		description: "back-fill file manifest",
+		migrate:     migrateMetadataBackfillManifest,
+	},
+	{
+		to:          3,
+		description: "back-fill origin",
+		migrate:     migrateMetadataBackfillOrigin,
+	},
+}
+
+func migrateMetadataBackfillHashAndSeason(dir string, fields map[string]json.RawMessage) (changes []string, err error) {
+	var hash string
+	if raw, ok := fields["hash"]; ok {
+		_ = json.Unmarshal(raw, &hash)
+	}
+	if hash == "" {
+		hash, err = hashSave(dir)
+		if err != nil {
+			err = fmt.Errorf("failed to hash backup '%s': %w", dir, err)
+			return
+		}
+		fields["hash"], _ = json.Marshal(hash)
+		changes = append(changes, "back-filled save hash")
+	}
+	if raw, ok := fields["season"]; !ok || string(raw) == "null" {
+		var saveData CompositeSave
+		saveData, err = readSave(dir)
+		if err != nil {
+			return
+		}
+		season := saveData.SeasonId()
+		fields["season"], _ = json.Marshal(season)
+		changes = append(changes, fmt.Sprintf("back-filled season (%s)", season))
+	}
+	return
+}
+
+func migrateMetadataBackfillManifest(dir string, fields map[string]json.RawMessage) (changes []string, err error) {
+	if raw, ok := fields["files"]; ok && string(raw) != "null" {
+		return
+	}
+	files, err := buildSaveManifest(dir)
+	if err != nil {
+		return
+	}
+	fields["files"], _ = json.Marshal(files)
+	changes = append(changes, "back-filled file manifest")
+	return
+}
+
+func migrateMetadataBackfillOrigin(dir string, fields map[string]json.RawMessage) (changes []string, err error) {
+	if raw, ok := fields["origin"]; ok && string(raw) != `""` && string(raw) != "null" {
+		return
+	}
+	var isAutoSave, isOverwritten bool
+	if raw, ok := fields["isAutoSave"]; ok {
+		_ = json.Unmarshal(raw, &isAutoSave)
+	}
+	if raw, ok := fields["isOverwritten"]; ok {
+		_ = json.Unmarshal(raw, &isOverwritten)
+	}
+	origin := defaultBackupOrigin(isAutoSave, isOverwritten)
+	fields["origin"], _ = json.Marshal(origin)
+	changes = append(changes, fmt.Sprintf("back-filled origin (%s)", origin))
+	return
+}
+
+// decodeBackupMetadata decodes the content of a metadata file, applying
+// migrations in memory if it was written with an older schema. changes
+// describes what the migrations changed; if non-empty, the metadata on disk is
+// outdated. If a migration fails, the unmigrated metadata is decoded on a best
+// effort basis alongside an error wrapping _errMetadataMigrationFailed.
+//
+// If the metadata is from a newer schema, known fields are still decoded on a
+// best effort basis, but an error wrapping _errMetadataFromNewerSchema is
+// returned, and the metadata must not be written back.
+func decodeBackupMetadata(encoded []byte, dir string) (metadata BackupMetadata, changes []string, err error) {
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(encoded, &fields); err != nil {
+		return
+	}
+	var version int
+	if raw, ok := fields["schemaVersion"]; ok {
+		if err = json.Unmarshal(raw, &version); err != nil {
+			err = fmt.Errorf("invalid schema version: %w", err)
+			return
+		}
+	}
+	if version > _metadataSchemaVersion {
+		_ = json.Unmarshal(encoded, &metadata)
+		err = fmt.Errorf("%w (schema version %d, supported up to %d)",
+			_errMetadataFromNewerSchema, version, _metadataSchemaVersion)
+		return
+	}
+	from := version
+	for _, m := range _metadataMigrations {
+		if m.to <= version {
+			continue
+		}
+		migrationChanges, migrateErr := m.migrate(dir, fields)
+		if migrateErr != nil {
+			_ = json.Unmarshal(encoded, &metadata)
+			err = fmt.Errorf("%w to schema version %d (%s): %w",
+				_errMetadataMigrationFailed, m.to, m.description, migrateErr)
+			return
+		}
+		changes = append(changes, migrationChanges...)
+		version = m.to
+		fields["schemaVersion"], _ = json.Marshal(version)
+	}
+	if version != from {
+		changes = append(changes, fmt.Sprintf("upgraded schema version from %d to %d", from, version))
+		encoded, _ = json.Marshal(fields)
+	}
+	err = json.Unmarshal(encoded, &metadata)
+	return
+}
+
+// backupMetadataJSON has the same fields as BackupMetadata, without the custom
+// (un)marshaling methods.
+type backupMetadataJSON BackupMetadata
+
+// UnmarshalJSON decodes known fields and keeps unknown fields (presumably
+// written by a newer version of AtSS) so that they survive a round trip.
+func (m *BackupMetadata) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*backupMetadataJSON)(m)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	known := jsonFieldNames(reflect.TypeOf(backupMetadataJSON{}))
+	m.unknownFields = nil
+	for k, v := range fields {
+		if !slices.Contains(known, k) {
+			if m.unknownFields == nil {
+				m.unknownFields = make(map[string]json.RawMessage)
+			}
+			m.unknownFields[k] = v
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes known fields in declaration order, followed by
+// preserved unknown fields in lexical order.
+func (m BackupMetadata) MarshalJSON() ([]byte, error) {
+	encoded, err := json.Marshal(backupMetadataJSON(m))
+	if err != nil || len(m.unknownFields) == 0 {
+		return encoded, err
+	}
+	var buf bytes.Buffer
+	buf.Write(bytes.TrimSuffix(encoded, []byte("}")))
+	keys := make([]string, 0, len(m.unknownFields))
+	for k := range m.unknownFields {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		encodedKey, _ := json.Marshal(k)
+		buf.WriteByte(',')
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(m.unknownFields[k])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func jsonFieldNames(t reflect.Type) (names []string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return
+}
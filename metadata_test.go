@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeTestSave writes a minimal valid MetaSave.save and Save.save to dir.
+func writeTestSave(t *testing.T, dir string, hasActiveGame bool, year, season int) {
+	t.Helper()
+	files := map[string]string{
+		"MetaSave.save": fmt.Sprintf(`{"gameplay":{"hasActiveGame":%t}}`, hasActiveGame),
+		"Save.save":     fmt.Sprintf(`{"gameplay":{"year":%d,"season":%d}}`, year, season),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeBackupMetadata(t *testing.T) {
+	saveDir := t.TempDir()
+	writeTestSave(t, saveDir, true, 2, 1)
+	hash, err := hashSave(saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emptyDir := t.TempDir()
+
+	tests := []struct {
+		name        string
+		encoded     string
+		dir         string
+		wantErr     error
+		wantChanges []string
+		wantVersion int
+		wantOrigin  BackupOrigin
+		wantSeason  SeasonId
+	}{
+		{
+			name:        "v0 back-fills everything",
+			encoded:     `{"createdAt":"2024-01-02T03:04:05Z","isAutoSave":true,"note":"n"}`,
+			dir:         saveDir,
+			wantChanges: []string{"back-filled save hash", "back-filled season (Y2 clearance)", "back-filled file manifest", "back-filled origin (autosave)", "upgraded schema version from 0 to 3"},
+			wantVersion: 3,
+			wantOrigin:  _originAutosave,
+			wantSeason:  5,
+		},
+		{
+			name:        "v1 keeps recorded hash and season",
+			encoded:     fmt.Sprintf(`{"schemaVersion":1,"isOverwritten":true,"hash":%q,"season":0}`, hash),
+			dir:         saveDir,
+			wantChanges: []string{"back-filled file manifest", "back-filled origin (restore)", "upgraded schema version from 1 to 3"},
+			wantVersion: 3,
+			wantOrigin:  _originRestore,
+			wantSeason:  0,
+		},
+		{
+			name:        "v2 back-fills origin only",
+			encoded:     `{"schemaVersion":2,"season":3,"files":[]}`,
+			dir:         emptyDir,
+			wantChanges: []string{"back-filled origin (manual)", "upgraded schema version from 2 to 3"},
+			wantVersion: 3,
+			wantOrigin:  _originManual,
+			wantSeason:  3,
+		},
+		{
+			name:        "current schema is left alone",
+			encoded:     `{"schemaVersion":3,"origin":"scheduled","season":6,"files":[]}`,
+			dir:         emptyDir,
+			wantVersion: 3,
+			wantOrigin:  _originScheduled,
+			wantSeason:  6,
+		},
+		{
+			name:        "newer schema is decoded on a best effort basis",
+			encoded:     `{"schemaVersion":4,"origin":"manual","season":1,"shiny":true}`,
+			dir:         emptyDir,
+			wantErr:     _errMetadataFromNewerSchema,
+			wantVersion: 4,
+			wantOrigin:  _originManual,
+			wantSeason:  1,
+		},
+		{
+			name:        "failed migration keeps unmigrated fields",
+			encoded:     `{"schemaVersion":0,"note":"n"}`,
+			dir:         emptyDir,
+			wantErr:     _errMetadataMigrationFailed,
+			wantVersion: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, changes, err := decodeBackupMetadata([]byte(tt.encoded), tt.dir)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(changes, tt.wantChanges) {
+				t.Errorf("changes = %q, want %q", changes, tt.wantChanges)
+			}
+			if metadata.SchemaVersion != tt.wantVersion {
+				t.Errorf("schema version = %d, want %d", metadata.SchemaVersion, tt.wantVersion)
+			}
+			if metadata.Origin != tt.wantOrigin {
+				t.Errorf("origin = %q, want %q", metadata.Origin, tt.wantOrigin)
+			}
+			if tt.wantErr == _errMetadataMigrationFailed {
+				return
+			}
+			if metadata.Season == nil || *metadata.Season != tt.wantSeason {
+				t.Errorf("season = %v, want %s", metadata.Season, tt.wantSeason)
+			}
+		})
+	}
+}
+
+func TestDecodeBackupMetadataBackfilledHash(t *testing.T) {
+	dir := t.TempDir()
+	writeTestSave(t, dir, false, 1, 0)
+	want, err := hashSave(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, _, err := decodeBackupMetadata([]byte(`{}`), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Hash != want {
+		t.Errorf("hash = %s, want %s", metadata.Hash, want)
+	}
+	if len(metadata.Files) != 2 {
+		t.Errorf("manifest has %d files, want 2", len(metadata.Files))
+	}
+}
+
+func TestBackupMetadataUnknownFieldsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		want    string
+	}{
+		{
+			name:    "no unknown fields",
+			encoded: `{"schemaVersion":3,"note":"n"}`,
+			want:    `{"schemaVersion":3,"createdAt":"0001-01-01T00:00:00Z","isAutoSave":false,"isOverwritten":false,"origin":"","hash":"","note":"n","season":null,"files":null}`,
+		},
+		{
+			name:    "unknown fields follow known fields in lexical order",
+			encoded: `{"zeta":{"a":[1,2]},"schemaVersion":3,"alpha":"x","pinned":true}`,
+			want:    `{"schemaVersion":3,"createdAt":"0001-01-01T00:00:00Z","isAutoSave":false,"isOverwritten":false,"origin":"","hash":"","note":"","season":null,"files":null,"pinned":true,"alpha":"x","zeta":{"a":[1,2]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var metadata BackupMetadata
+			if err := json.Unmarshal([]byte(tt.encoded), &metadata); err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := json.Marshal(metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(encoded) != tt.want {
+				t.Errorf("encoded = %s, want %s", encoded, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// Output formats of command results, chosen with the global --output flag. In
+// JSON mode, each command prints a single commandResult to stdout (autosave
+// prints one report per line instead), and never prompts.
+const (
+	_outputText = "text"
+	_outputJSON = "json"
+)
+
+var _outputFormat string
+
+func jsonOutput() bool {
+	return _outputFormat == _outputJSON
+}
+
+// Exit codes, documented in the README.
+const (
+	_exitOK               = 0
+	_exitError            = 1
+	_exitUsage            = 2
+	_exitNotFound         = 3
+	_exitGameRunning      = 4
+	_exitValidationFailed = 5
+	_exitLockHeld         = 6
+	_exitAutosaveStopped  = 7
+)
+
+var _errUsage = errors.New("invalid usage")
+
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return _exitOK
+	case errors.Is(err, _errUsage):
+		return _exitUsage
+	case errors.Is(err, _errBackupNotFound):
+		return _exitNotFound
+	case errors.Is(err, _errGameIsRunningRestoreRefused):
+		return _exitGameRunning
+	case errors.Is(err, _errVerificationFailed), errors.Is(err, _errVetoedByHook),
+		errors.Is(err, _errMetadataFromNewerSchema), errors.Is(err, _errMetadataMigrationFailed):
+		return _exitValidationFailed
+	case errors.Is(err, _errLockHeld):
+		return _exitLockHeld
+	case errors.Is(err, _errAutosaveNotRunning):
+		return _exitAutosaveStopped
+	default:
+		return _exitError
+	}
+}
+
+// commandResult is what a command prints in JSON mode.
+type commandResult struct {
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exitCode"`
+	// The backup created, restored or triggered.
+	Backup *apiBackup `json:"backup,omitempty"`
+	// The backup of the state overwritten by a restore.
+	OverwrittenBackup *apiBackup `json:"overwrittenBackup,omitempty"`
+	// The backups listed or deleted.
+	Backups  []apiBackup     `json:"backups,omitempty"`
+	Autosave *autosaveStatus `json:"autosave,omitempty"`
+	Warnings []string        `json:"warnings,omitempty"`
+}
+
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Errorf("failed to write output: %s", err)
+	}
+}
+
+// succeed prints result in JSON mode, and calls text otherwise.
+func succeed(result commandResult, text func()) {
+	if !jsonOutput() {
+		text()
+		return
+	}
+	result.OK = true
+	result.Warnings = log.Warnings()
+	printJSON(result)
+}
+
+// fail exits with the exit code of err, printing it as a result in JSON mode.
+func fail(err error) {
+	code := exitCode(err)
+	if jsonOutput() {
+		printJSON(commandResult{Error: err.Error(), ExitCode: code, Warnings: log.Warnings()})
+		log.Exit(code)
+	}
+	log.FatalWithCode(code, err)
+}
+
+// requireText fails with a usage error in JSON mode, for text-only output.
+func requireText(what string) {
+	if jsonOutput() {
+		fail(fmt.Errorf("%w: %s with --output json", _errUsage, what))
+	}
+}
+
+// requireInteractive fails with a usage error unless the user can be prompted:
+// stdin is a terminal, and not in JSON mode. need tells what to pass on the
+// command line instead.
+func requireInteractive(need string) {
+	switch {
+	case jsonOutput():
+		fail(fmt.Errorf("%w: can't prompt with --output json; %s", _errUsage, need))
+	case !isInteractive():
+		fail(fmt.Errorf("%w: can't prompt since stdin is not a terminal; %s", _errUsage, need))
+	}
+}
+
+func newAPIBackups(backups []Backup) []apiBackup {
+	result := make([]apiBackup, 0, len(backups))
+	for _, b := range backups {
+		result = append(result, newAPIBackup(b))
+	}
+	return result
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// autoBackupState is the state of the save observed after a debounced save
+// update.
+type autoBackupState struct {
+	Season SeasonId
+	// Number of debounced save updates observed since autosave started,
+	// including this one.
+	Updates int
+}
+
+// autoBackupPolicy decides whether a save update should be backed up, given
+// the state at the last update (nil if this is the first one) and the current
+// state.
+type autoBackupPolicy interface {
+	decide(prev *autoBackupState, cur autoBackupState) (backup bool, reason string)
+}
+
+type autoBackupPolicyFunc func(prev *autoBackupState, cur autoBackupState) (bool, string)
+
+func (f autoBackupPolicyFunc) decide(prev *autoBackupState, cur autoBackupState) (bool, string) {
+	return f(prev, cur)
+}
+
+// _autoBackupPolicies maps trigger names to policy constructors, which take N
+// for every-n.
+var _autoBackupPolicies = map[string]func(n int) autoBackupPolicy{
+	"always": func(int) autoBackupPolicy {
+		return autoBackupPolicyFunc(func(prev *autoBackupState, cur autoBackupState) (bool, string) {
+			return true, "save updated"
+		})
+	},
+	"season-change": func(int) autoBackupPolicy {
+		return autoBackupPolicyFunc(func(prev *autoBackupState, cur autoBackupState) (bool, string) {
+			if prev == nil || cur.Season != prev.Season {
+				return true, fmt.Sprintf("season changed to %s", cur.Season)
+			}
+			return false, fmt.Sprintf("season unchanged (%s)", cur.Season)
+		})
+	},
+	"storm-start": func(int) autoBackupPolicy {
+		return autoBackupPolicyFunc(func(prev *autoBackupState, cur autoBackupState) (bool, string) {
+			if cur.Season.IsValid() && !cur.Season.IsWorldMap() && cur.Season.IsStorm() &&
+				(prev == nil || cur.Season != prev.Season) {
+				return true, fmt.Sprintf("storm started (%s)", cur.Season)
+			}
+			return false, fmt.Sprintf("not the start of a storm (%s)", cur.Season)
+		})
+	},
+	"world-map": func(int) autoBackupPolicy {
+		return autoBackupPolicyFunc(func(prev *autoBackupState, cur autoBackupState) (bool, string) {
+			if cur.Season.IsWorldMap() && (prev == nil || !prev.Season.IsWorldMap()) {
+				return true, "returned to world map"
+			}
+			return false, fmt.Sprintf("not returning to world map (%s)", cur.Season)
+		})
+	},
+	"every-n": func(n int) autoBackupPolicy {
+		return autoBackupPolicyFunc(func(prev *autoBackupState, cur autoBackupState) (bool, string) {
+			if cur.Updates%n == 0 {
+				return true, fmt.Sprintf("save update #%d", cur.Updates)
+			}
+			return false, fmt.Sprintf("save update #%d, backing up every %d", cur.Updates, n)
+		})
+	},
+}
+
+func autoBackupPolicyNames() []string {
+	var names []string
+	for name := range _autoBackupPolicies {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// anyAutoBackupPolicy backs up if any of its policies does.
+type anyAutoBackupPolicy []autoBackupPolicy
+
+func (policies anyAutoBackupPolicy) decide(prev *autoBackupState, cur autoBackupState) (bool, string) {
+	var reasons []string
+	for _, p := range policies {
+		backup, reason := p.decide(prev, cur)
+		if backup {
+			return true, reason
+		}
+		reasons = append(reasons, reason)
+	}
+	return false, strings.Join(reasons, "; ")
+}
+
+func newAutoBackupPolicy(triggers []string, everyN int) (autoBackupPolicy, error) {
+	if len(triggers) == 0 {
+		triggers = []string{"always"}
+	}
+	var policies anyAutoBackupPolicy
+	for _, name := range triggers {
+		newPolicy, ok := _autoBackupPolicies[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown autosave trigger '%s', expected one of %s",
+				name, strings.Join(autoBackupPolicyNames(), ", "))
+		}
+		if name == "every-n" && everyN < 1 {
+			return nil, fmt.Errorf("autosave trigger every-n requires N >= 1, got %d", everyN)
+		}
+		policies = append(policies, newPolicy(everyN))
+	}
+	return policies, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAutoBackupPolicy(t *testing.T) {
+	drizzle := autoBackupState{Season: 4, Updates: 2}
+	storm := autoBackupState{Season: 6, Updates: 3}
+	worldMap := autoBackupState{Season: 0, Updates: 4}
+
+	tests := []struct {
+		name     string
+		triggers []string
+		everyN   int
+		prev     *autoBackupState
+		cur      autoBackupState
+		want     bool
+	}{
+		{"default is always", nil, 0, &drizzle, drizzle, true},
+		{"season-change on first update", []string{"season-change"}, 0, nil, drizzle, true},
+		{"season-change same season", []string{"season-change"}, 0, &drizzle, drizzle, false},
+		{"season-change new season", []string{"season-change"}, 0, &drizzle, storm, true},
+		{"storm-start entering storm", []string{"storm-start"}, 0, &drizzle, storm, true},
+		{"storm-start during storm", []string{"storm-start"}, 0, &storm, storm, false},
+		{"storm-start not a storm", []string{"storm-start"}, 0, nil, drizzle, false},
+		{"storm-start world map", []string{"storm-start"}, 0, &storm, worldMap, false},
+		{"world-map returning", []string{"world-map"}, 0, &storm, worldMap, true},
+		{"world-map staying", []string{"world-map"}, 0, &worldMap, worldMap, false},
+		{"world-map in settlement", []string{"world-map"}, 0, nil, drizzle, false},
+		{"every-n multiple", []string{"every-n"}, 2, nil, worldMap, true},
+		{"every-n not a multiple", []string{"every-n"}, 2, nil, storm, false},
+		{"any of several", []string{"world-map", "season-change"}, 0, &drizzle, storm, true},
+		{"none of several", []string{"world-map", "storm-start"}, 0, &drizzle, drizzle, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := newAutoBackupPolicy(tt.triggers, tt.everyN)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, reason := policy.decide(tt.prev, tt.cur); got != tt.want {
+				t.Errorf("decide = %t (%s), want %t", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAutoBackupPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		triggers []string
+		everyN   int
+	}{
+		{"unknown trigger", []string{"always", "sometimes"}, 0},
+		{"every-n without N", []string{"every-n"}, 0},
+		{"every-n with negative N", []string{"every-n"}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newAutoBackupPolicy(tt.triggers, tt.everyN); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
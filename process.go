@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+const (
+	_gameMonitorInterval = 2 * time.Second
+	// Play sessions are appended to this file in the backups root directory as
+	// JSON lines when the game exits.
+	_sessionLogFilename = "atss-sessions.jsonl"
+)
+
+// GameSession is a period during which the game was running, as observed by
+// autosave. StartedAt is when the game was first seen running, which may be
+// later than the actual start if autosave was started afterwards.
+type GameSession struct {
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+}
+
+// gameProcessEvent reports that the game started (Session.EndedAt is nil) or
+// exited.
+type gameProcessEvent struct {
+	Session GameSession
+}
+
+func (e gameProcessEvent) running() bool {
+	return e.Session.EndedAt == nil
+}
+
+// monitorGameProcess polls the process list until ctx is done, and sends an
+// event whenever the game starts or exits, including when it's found running
+// initially.
+func monitorGameProcess(ctx context.Context, interval time.Duration) <-chan gameProcessEvent {
+	ch := make(chan gameProcessEvent)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var session *GameSession
+		for {
+			running, err := processIsRunning(_againstTheStormExecutable)
+			if err != nil {
+				log.Warn(err)
+			} else if running && session == nil {
+				session = &GameSession{StartedAt: time.Now().Truncate(time.Second)}
+				select {
+				case ch <- gameProcessEvent{Session: *session}:
+				case <-ctx.Done():
+					return
+				}
+			} else if !running && session != nil {
+				endedAt := time.Now().Truncate(time.Second)
+				session.EndedAt = &endedAt
+				select {
+				case ch <- gameProcessEvent{Session: *session}:
+				case <-ctx.Done():
+					return
+				}
+				session = nil
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// waitForGameExit blocks until the game is not running, or ctx is done. poll,
+// if not nil, is called each time the game is found still running.
+func waitForGameExit(ctx context.Context, poll func()) error {
+	ticker := time.NewTicker(_gameMonitorInterval)
+	defer ticker.Stop()
+	for {
+		running, err := processIsRunning(_againstTheStormExecutable)
+		if err != nil {
+			return err
+		}
+		if !running {
+			return nil
+		}
+		if poll != nil {
+			poll()
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func appendSessionLog(session GameSession) error {
+	return appendJSONLines(filepath.Join(_backupsDirectory, _sessionLogFilename), session)
+}
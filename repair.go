@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// repairBackups brings the metadata files of all backups up to date, reporting
+// every change made. Nothing is written if dryRun.
+func repairBackups(dryRun bool) error {
+	unlock, err := lockStore()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	dirs, _ := filepath.Glob(filepath.Join(_backupsDirectory, "Bak.*"))
+	var repaired, failed int
+	for _, dir := range dirs {
+		backup, repairs, err := inspectBackup(dir)
+		if err != nil {
+			log.Errorf("cannot repair '%s': %s", dir, err)
+			failed++
+			continue
+		}
+		if len(repairs) == 0 {
+			continue
+		}
+		for _, r := range repairs {
+			log.Infof("%s: %s", filepath.Base(dir), r)
+		}
+		if dryRun {
+			repaired++
+			continue
+		}
+		// Keep a copy of the existing metadata file in case it's undecodable
+		// rather than merely outdated.
+		metadataFile := filepath.Join(dir, _metadataFilename)
+		if _, err := os.Stat(metadataFile); err == nil {
+			if err := copyFile(metadataFile, metadataFile+".bak"); err != nil {
+				log.Errorf("failed to back up metadata of '%s', skipping: %s", dir, err)
+				failed++
+				continue
+			}
+		}
+		if err := writeBackupMetadata(backup.Metadata, dir); err != nil {
+			log.Errorf("failed to repair '%s': %s", dir, err)
+			failed++
+			continue
+		}
+		repaired++
+	}
+	if dryRun {
+		log.Infof("%d of %d backups need repair, %d cannot be repaired", repaired, len(dirs), failed)
+		return nil
+	}
+	log.Infof("repaired %d of %d backups, %d failed", repaired, len(dirs), failed)
+	if _, err := rebuildBackupIndex(dirs); err != nil {
+		return err
+	}
+	return nil
+}
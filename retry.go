@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// retryPolicy retries operations failing with transient errors, e.g. when the
+// game holds a save file open while writing it, with exponential backoff and
+// jitter.
+type retryPolicy struct {
+	Attempts     int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// Each delay is randomized by up to this fraction in either direction.
+	Jitter float64
+}
+
+var _saveFileRetryPolicy = retryPolicy{
+	Attempts:     6,
+	InitialDelay: 250 * time.Millisecond,
+	MaxDelay:     4 * time.Second,
+	Jitter:       0.25,
+}
+
+func (p retryPolicy) delay(retry int) time.Duration {
+	d := p.InitialDelay << retry
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	return time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+}
+
+// do calls fn until it succeeds or fails with an error that isn't transient,
+// up to the number of attempts of the policy. what describes the operation in
+// logs. retries is the number of failed attempts that were retried.
+func (p retryPolicy) do(what string, fn func() error) (retries int, err error) {
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !isTransientFileError(err) {
+			return
+		}
+		if attempt >= p.Attempts {
+			err = fmt.Errorf("%s still failing after %d attempts: %w", what, attempt, err)
+			return
+		}
+		delay := p.delay(retries)
+		log.Warnf("%s failed (attempt %d/%d), retrying in %s: %s", what, attempt, p.Attempts, delay.Round(time.Millisecond), err)
+		time.Sleep(delay)
+		retries++
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var _testTransientFileError error = &os.PathError{Op: "open", Path: "Save.save", Err: syscall.EBUSY}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := retryPolicy{Attempts: 3, InitialDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	permanent := &os.PathError{Op: "open", Path: "Save.save", Err: os.ErrNotExist}
+
+	tests := []struct {
+		name        string
+		failures    []error
+		wantCalls   int
+		wantRetries int
+		wantErr     error
+	}{
+		{"succeeds", nil, 1, 0, nil},
+		{"succeeds after transient errors", []error{_testTransientFileError, _testTransientFileError}, 3, 2, nil},
+		{"gives up after the attempts", []error{_testTransientFileError, _testTransientFileError, _testTransientFileError}, 3, 2, _testTransientFileError},
+		{"doesn't retry other errors", []error{permanent}, 1, 0, permanent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			retries, err := policy.do("opening", func() error {
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls || retries != tt.wantRetries {
+				t.Errorf("%d calls and %d retries, want %d and %d", calls, retries, tt.wantCalls, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := retryPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.5}
+	for retry, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := policy.delay(retry); d < want/2 || d > want*3/2 {
+				t.Errorf("delay(%d) = %s, want %s ± 50%%", retry, d, want)
+			}
+		}
+	}
+	// Shifting far enough overflows, which must not yield a negative delay.
+	if d := (retryPolicy{InitialDelay: time.Second, MaxDelay: time.Minute}).delay(70); d != time.Minute {
+		t.Errorf("delay(70) = %s, want %s", d, time.Minute)
+	}
+}
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var _testTransientFileError error = &os.PathError{Op: "open", Path: "Save.save", Err: windows.ERROR_SHARING_VIOLATION}
@@ -6,8 +6,11 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/go-playground/validator/v10"
 	"github.com/winlabs/gowin32"
 	"golang.org/x/crypto/blake2b"
@@ -46,9 +49,21 @@ type RawSave struct {
 	Gameplay *struct {
 		Year   *int `json:"year" validate:"required"`   // 1-based
 		Season *int `json:"season" validate:"required"` // 0, 1, 2
+		// Optional, only used for event detection.
+		Biome      *string `json:"biome" validate:"omitempty,max=100"`
+		IsGameWon  *bool   `json:"isGameWon" validate:"omitempty"`
+		IsGameLost *bool   `json:"isGameLost" validate:"omitempty"`
 	} `json:"gameplay" validate:"required"`
 }
 
+// RawWorldSave is for WorldSave.save. It's only used for event detection, so
+// all fields are optional.
+type RawWorldSave struct {
+	Gameplay *struct {
+		Cycle *int `json:"cycle" validate:"omitempty,min=1"` // 1-based
+	} `json:"gameplay"`
+}
+
 // 0 for world map (no active settlement), 3n-2 for year n drizzle, 3n-1 for
 // year n clearance, 3n for year n storm. -1 for invalid.
 type SeasonId int
@@ -122,6 +137,131 @@ func hashSave(dir string) (hash string, err error) {
 		_, _ = h.Write([]byte("\000"))
 	}
 	hash = fmt.Sprintf("%x", h.Sum(nil))
+	log.Debugf("hashed %d save files in '%s': %s", len(saveFiles), dir, hash)
+	return
+}
+
+// SaveFile is an entry in the manifest of a set of save files.
+type SaveFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Hash    string    `json:"hash"`
+}
+
+func buildSaveManifest(dir string) (files []SaveFile, err error) {
+	pattern := filepath.Join(dir, "*.save")
+	saveFiles, _ := filepath.Glob(pattern)
+	if len(saveFiles) == 0 {
+		err = fmt.Errorf("failed to find save files '%s'", pattern)
+		return
+	}
+	for _, f := range saveFiles {
+		var file SaveFile
+		file, err = describeSaveFile(f)
+		if err != nil {
+			return
+		}
+		files = append(files, file)
+	}
+	return
+}
+
+func describeSaveFile(path string) (file SaveFile, err error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		err = fmt.Errorf("failed to stat save file '%s': %w", path, err)
+		return
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("failed to read save file '%s': %w", path, err)
+		return
+	}
+	sum := blake2b.Sum512(content)
+	file = SaveFile{
+		Name:    filepath.Base(path),
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+		Hash:    fmt.Sprintf("%x", sum),
+	}
+	return
+}
+
+type saveFileDiffStatus int
+
+const (
+	_saveFileIdentical saveFileDiffStatus = iota
+	_saveFileModified
+	_saveFileOnlyInBackup
+	_saveFileOnlyInCurrent
+)
+
+func (s saveFileDiffStatus) String() string {
+	switch s {
+	case _saveFileIdentical:
+		return "identical"
+	case _saveFileModified:
+		return "modified"
+	case _saveFileOnlyInBackup:
+		return "only in backup"
+	case _saveFileOnlyInCurrent:
+		return "only in current save"
+	}
+	return "unknown"
+}
+
+// saveFileDiff compares a file in a backup with the corresponding file in the
+// current save. Backup or Current is nil if the file is missing on that side.
+type saveFileDiff struct {
+	Name    string
+	Status  saveFileDiffStatus
+	Backup  *SaveFile
+	Current *SaveFile
+}
+
+func (d saveFileDiff) String() string {
+	s := fmt.Sprintf("%s: %s", d.Name, d.Status)
+	if d.Status == _saveFileModified {
+		s += fmt.Sprintf(" (backup %s from %s, current %s from %s)",
+			humanize.Bytes(uint64(d.Backup.Size)), d.Backup.ModTime.Format("2006-01-02 15:04:05"),
+			humanize.Bytes(uint64(d.Current.Size)), d.Current.ModTime.Format("2006-01-02 15:04:05"))
+	}
+	return s
+}
+
+// diffSaveManifests compares the manifest of a backup against that of the
+// current save. The result is sorted by file name.
+func diffSaveManifests(backup, current []SaveFile) (diffs []saveFileDiff) {
+	currentByName := make(map[string]*SaveFile)
+	for i := range current {
+		currentByName[current[i].Name] = &current[i]
+	}
+	seen := make(map[string]bool)
+	for i := range backup {
+		b := &backup[i]
+		seen[b.Name] = true
+		c := currentByName[b.Name]
+		d := saveFileDiff{Name: b.Name, Backup: b, Current: c}
+		switch {
+		case c == nil:
+			d.Status = _saveFileOnlyInBackup
+		case c.Hash != b.Hash:
+			d.Status = _saveFileModified
+		default:
+			d.Status = _saveFileIdentical
+		}
+		diffs = append(diffs, d)
+	}
+	for i := range current {
+		c := &current[i]
+		if !seen[c.Name] {
+			diffs = append(diffs, saveFileDiff{Name: c.Name, Status: _saveFileOnlyInCurrent, Current: c})
+		}
+	}
+	slices.SortFunc(diffs, func(d1, d2 saveFileDiff) int {
+		return strings.Compare(d1.Name, d2.Name)
+	})
 	return
 }
 
@@ -163,6 +303,23 @@ func readSave(dir string) (save CompositeSave, err error) {
 	return
 }
 
+func readWorldSave(dir string) (save RawWorldSave, err error) {
+	path := filepath.Join(dir, "WorldSave.save")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("failed to read '%s': %w", path, err)
+		return
+	}
+	if err = json.Unmarshal(content, &save); err != nil {
+		err = fmt.Errorf("failed to parse '%s': %w", path, err)
+		return
+	}
+	if err = _validate.Struct(save); err != nil {
+		err = fmt.Errorf("failed to validate parsed '%s': %w", path, err)
+	}
+	return
+}
+
 func (s CompositeSave) SeasonId() (sid SeasonId) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+const _defaultServeAddr = "127.0.0.1:8734"
+
+//go:embed web
+var _webFS embed.FS
+
+// apiServer exposes the backup store over a local HTTP JSON API, and serves
+// the web UI.
+type apiServer struct {
+	token string
+	// Serializes operations that modify the store or the saves.
+	mu sync.Mutex
+}
+
+type apiBackup struct {
+	ID       string         `json:"id"`
+	Dir      string         `json:"dir"`
+	Season   string         `json:"season"`
+	Metadata BackupMetadata `json:"metadata"`
+}
+
+func newAPIBackup(b Backup) apiBackup {
+	season := _invalidSeasonId
+	if b.Metadata.Season != nil {
+		season = *b.Metadata.Season
+	}
+	return apiBackup{
+		ID:       filepath.Base(b.Dir),
+		Dir:      b.Dir,
+		Season:   season.String(),
+		Metadata: b.Metadata,
+	}
+}
+
+type apiStatus struct {
+	SavesDirectory   string    `json:"savesDirectory"`
+	BackupsDirectory string    `json:"backupsDirectory"`
+	BackupCount      int       `json:"backupCount"`
+	GameRunning      bool      `json:"gameRunning"`
+	Season           string    `json:"season"`
+	SaveModifiedAt   time.Time `json:"saveModifiedAt"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// serveAPI serves the API and web UI on addr until an error occurs. A token is
+// required unless addr is a loopback address.
+func serveAPI(addr, token string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address '%s': %w", addr, err)
+	}
+	if ip := net.ParseIP(host); token == "" && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("refusing to listen on non-loopback address '%s' without a token", addr)
+	}
+	s := &apiServer{token: token}
+	webRoot, _ := fs.Sub(_webFS, "web")
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(webRoot)))
+	mux.Handle("/api/", s.authenticated(http.HandlerFunc(s.handleAPI)))
+	log.Infof("serving on http://%s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+func (s *apiServer) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reason := s.checkRequestSource(r); reason != "" {
+			writeJSON(w, http.StatusForbidden, apiError{reason})
+			return
+		}
+		if s.token != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" {
+				token = r.URL.Query().Get("token")
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				writeJSON(w, http.StatusUnauthorized, apiError{"invalid or missing token"})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAPI routes requests:
+//
+//	GET    /api/status
+//	GET    /api/backups
+//	POST   /api/backups                 {"note": ...}
+//	GET    /api/backups/{id}
+//	PATCH  /api/backups/{id}            {"note": ...}
+//	DELETE /api/backups/{id}
+//	POST   /api/backups/{id}/restore    {"files": [...], "settlementOnly": ...}
+func (s *apiServer) handleAPI(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/"), "/")
+	route := r.Method + " " + parts[0]
+	switch {
+	case route == "GET status" && len(parts) == 1:
+		s.handleStatus(w, r)
+	case route == "GET backups" && len(parts) == 1:
+		s.handleListBackups(w, r)
+	case route == "POST backups" && len(parts) == 1:
+		s.handleCreateBackup(w, r)
+	case parts[0] == "backups" && len(parts) == 2:
+		backup, err := findBackup(parts[1])
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, newAPIBackup(backup))
+		case http.MethodPatch:
+			s.handleAnnotateBackup(w, r, backup)
+		case http.MethodDelete:
+			s.handleDeleteBackup(w, r, backup)
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, apiError{"method not allowed"})
+		}
+	case route == "POST backups" && len(parts) == 3 && parts[2] == "restore":
+		backup, err := findBackup(parts[1])
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		s.handleRestoreBackup(w, r, backup)
+	default:
+		writeJSON(w, http.StatusNotFound, apiError{"not found"})
+	}
+}
+
+func (s *apiServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := apiStatus{
+		SavesDirectory:   _savesDirectory,
+		BackupsDirectory: _backupsDirectory,
+	}
+	backups, err := getBackups()
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	status.BackupCount = len(backups)
+	status.GameRunning, err = processIsRunning(_againstTheStormExecutable)
+	if err != nil {
+		log.Warn(err)
+	}
+	saveData, err := readSave(_savesDirectory)
+	if err != nil {
+		log.Warn(err)
+	}
+	status.Season = saveData.SeasonId().String()
+	status.SaveModifiedAt, _, _ = getSaveAge(_savesDirectory)
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *apiServer) handleListBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := getBackups()
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIBackups(backups))
+}
+
+func (s *apiServer) handleCreateBackup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	backup, err := createBackup(BackupMetadata{Note: req.Note})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	log.Infof("created backup '%s'", backup.Dir)
+	writeJSON(w, http.StatusCreated, newAPIBackup(backup))
+}
+
+func (s *apiServer) handleAnnotateBackup(w http.ResponseWriter, r *http.Request, backup Backup) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	backup, err := annotateBackup(backup, req.Note)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIBackup(backup))
+}
+
+func (s *apiServer) handleDeleteBackup(w http.ResponseWriter, r *http.Request, backup Backup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := deleteBackup(backup); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	log.Infof("deleted backup '%s'", backup.Dir)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *apiServer) handleRestoreBackup(w http.ResponseWriter, r *http.Request, backup Backup) {
+	var scope restoreScope
+	if !decodeJSONBody(w, r, &scope) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	autoBackup, err := restoreBackup(backup, scope)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Restored    apiBackup `json:"restored"`
+		Overwritten apiBackup `json:"overwritten"`
+	}{newAPIBackup(backup), newAPIBackup(autoBackup)})
+}
+
+// checkRequestSource guards against web pages the user visits sending requests
+// to the API, returning why a request is rejected, or "" if it's fine:
+//
+//   - Without a token, the Host must be a loopback address, so that a page on
+//     a DNS rebinding domain can't read responses.
+//   - Cross-origin requests are refused, going by the Origin header.
+//   - Requests other than GET must have a JSON body, which cross-site pages
+//     can't send without a CORS preflight, which is never answered.
+func (s *apiServer) checkRequestSource(r *http.Request) string {
+	if s.token == "" && !isLoopbackHost(r.Host) {
+		return fmt.Sprintf("host '%s' is not a loopback address", r.Host)
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return fmt.Sprintf("cross-origin request from '%s' refused", origin)
+		}
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/json" {
+			return "Content-Type must be application/json"
+		}
+	}
+	return ""
+}
+
+func isLoopbackHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	host = strings.Trim(host, "[]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// decodeJSONBody decodes the request body if there is one, and writes an error
+// response and returns false on failure.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{fmt.Sprintf("invalid request body: %s", err)})
+		return false
+	}
+	return true
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, _errBackupNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, _errGameIsRunningRestoreRefused), errors.Is(err, _errVetoedByHook), errors.Is(err, _errLockHeld):
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, apiError{err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warnf("failed to write response: %s", err)
+	}
+}
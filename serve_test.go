@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckRequestSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		token       string
+		method      string
+		host        string
+		origin      string
+		contentType string
+		wantOK      bool
+	}{
+		{"GET from loopback", "", "GET", "127.0.0.1:8080", "", "", true},
+		{"GET from localhost", "", "GET", "localhost:8080", "", "", true},
+		{"GET from IPv6 loopback", "", "GET", "[::1]:8080", "", "", true},
+		{"DNS rebinding host", "", "GET", "evil.example:8080", "", "", false},
+		{"non-loopback host with token", "secret", "GET", "192.168.1.2:8080", "", "", true},
+		{"same origin", "", "POST", "127.0.0.1:8080", "http://127.0.0.1:8080", "application/json", true},
+		{"cross origin", "", "GET", "127.0.0.1:8080", "http://evil.example", "", false},
+		{"cross origin with token", "secret", "POST", "127.0.0.1:8080", "http://evil.example", "application/json", false},
+		{"unparsable origin", "", "GET", "127.0.0.1:8080", "://", "", false},
+		{"POST with JSON and charset", "", "POST", "127.0.0.1:8080", "", "application/json; charset=utf-8", true},
+		{"POST without content type", "", "POST", "127.0.0.1:8080", "", "", false},
+		{"form POST", "", "POST", "127.0.0.1:8080", "", "application/x-www-form-urlencoded", false},
+		{"text DELETE", "", "DELETE", "127.0.0.1:8080", "", "text/plain", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &apiServer{token: tt.token}
+			r := httptest.NewRequest(tt.method, "/api/backups", nil)
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			if reason := s.checkRequestSource(r); (reason == "") != tt.wantOK {
+				t.Errorf("checkRequestSource = %q, want ok %t", reason, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const _serviceName = "atss-autosave"
+
+// serviceDefinition generates a schtasks command creating a logon task that
+// runs headless autosave. AtSS only runs on Windows, so there are no service
+// definitions for other systems. instructions explains how to install it.
+func serviceDefinition() (definition string, instructions string, err error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to locate executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	definition = fmt.Sprintf(`schtasks /Create /F /SC ONLOGON /RL LIMITED /TN "%s" /TR "\"%s\" autosave --headless"`+"\n", _serviceName, executable)
+	instructions = fmt.Sprintf("run the command above to start autosave at logon; remove the task with: schtasks /Delete /TN \"%s\"", _serviceName)
+	return
+}
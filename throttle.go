@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// autoBackupThrottle limits how often autosave backs up, to avoid floods of
+// backups while the game is saving heavily.
+type autoBackupThrottle struct {
+	minInterval time.Duration
+	maxPerHour  int
+	// Times of backups within the last hour.
+	recent []time.Time
+}
+
+// wait returns how long until the next backup is allowed, zero if it's
+// allowed now, along with the reason if not.
+func (t *autoBackupThrottle) wait(now time.Time) (wait time.Duration, reason string) {
+	t.recent = slices.DeleteFunc(t.recent, func(b time.Time) bool {
+		return now.Sub(b) >= time.Hour
+	})
+	if len(t.recent) == 0 {
+		return 0, ""
+	}
+	last := t.recent[len(t.recent)-1]
+	if t.minInterval > 0 && now.Sub(last) < t.minInterval {
+		wait = t.minInterval - now.Sub(last)
+		reason = fmt.Sprintf("less than %s since the last backup", t.minInterval)
+	}
+	if t.maxPerHour > 0 && len(t.recent) >= t.maxPerHour {
+		// Wait for the oldest backup to fall out of the window.
+		if w := time.Hour - now.Sub(t.recent[len(t.recent)-t.maxPerHour]); w > wait {
+			wait = w
+			reason = fmt.Sprintf("already backed up %d times in the last hour", len(t.recent))
+		}
+	}
+	return
+}
+
+func (t *autoBackupThrottle) record(now time.Time) {
+	t.recent = append(t.recent, now)
+}
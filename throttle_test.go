@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoBackupThrottleWait(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time {
+		return now.Add(-d)
+	}
+
+	tests := []struct {
+		name        string
+		minInterval time.Duration
+		maxPerHour  int
+		recent      []time.Time
+		want        time.Duration
+		wantRecent  int
+	}{
+		{"no backups yet", time.Minute, 1, nil, 0, 0},
+		{"unlimited", 0, 0, []time.Time{ago(time.Second)}, 0, 1},
+		{"within min interval", 5 * time.Minute, 0, []time.Time{ago(2 * time.Minute)}, 3 * time.Minute, 1},
+		{"past min interval", 5 * time.Minute, 0, []time.Time{ago(5 * time.Minute)}, 0, 1},
+		{"under hourly limit", 0, 3, []time.Time{ago(50 * time.Minute), ago(10 * time.Minute)}, 0, 2},
+		{"at hourly limit", 0, 2, []time.Time{ago(50 * time.Minute), ago(10 * time.Minute)}, 10 * time.Minute, 2},
+		{"hourly limit waits for oldest in limit", 0, 2, []time.Time{ago(55 * time.Minute), ago(40 * time.Minute), ago(10 * time.Minute)}, 20 * time.Minute, 3},
+		{"backups an hour old are pruned", 0, 1, []time.Time{ago(time.Hour), ago(2 * time.Hour)}, 0, 0},
+		{"longer of both limits", 15 * time.Minute, 1, []time.Time{ago(50 * time.Minute)}, 10 * time.Minute, 1},
+		{"longer of both limits, min interval", 15 * time.Minute, 2, []time.Time{ago(58 * time.Minute), ago(5 * time.Minute)}, 10 * time.Minute, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := autoBackupThrottle{minInterval: tt.minInterval, maxPerHour: tt.maxPerHour, recent: tt.recent}
+			got, reason := throttle.wait(now)
+			if got != tt.want {
+				t.Errorf("wait = %s, want %s", got, tt.want)
+			}
+			if (got > 0) != (reason != "") {
+				t.Errorf("reason = %q with wait %s", reason, got)
+			}
+			if len(throttle.recent) != tt.wantRecent {
+				t.Errorf("%d recent backups kept, want %d", len(throttle.recent), tt.wantRecent)
+			}
+		})
+	}
+}
+
+func TestAutoBackupThrottleRecord(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	throttle := autoBackupThrottle{minInterval: time.Minute}
+	throttle.record(now)
+	if got, _ := throttle.wait(now.Add(20 * time.Second)); got != 40*time.Second {
+		t.Errorf("wait = %s, want 40s", got)
+	}
+	if got, _ := throttle.wait(now.Add(time.Minute)); got != 0 {
+		t.Errorf("wait = %s, want 0", got)
+	}
+}
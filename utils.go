@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/mitchellh/go-ps"
+	"golang.org/x/term"
 )
 
 const (
@@ -41,6 +45,54 @@ func copyFile(src, dst string) error {
 	return nil
 }
 
+// writeFileAtomic writes data to a temporary file in the same directory first,
+// then renames it to name, so that readers never see a partially written file.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// appendJSONLines appends each value as a line of JSON to the file, which is
+// created if necessary.
+func appendJSONLines(name string, values ...any) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, v := range values {
+		if err := encoder.Encode(v); err != nil {
+			return fmt.Errorf("failed to encode line for '%s': %w", name, err)
+		}
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open '%s' for appending: %w", name, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to append to '%s': %w", name, err)
+	}
+	return nil
+}
+
+// isInteractive reports whether the user can be prompted, i.e. stdin is a
+// terminal rather than e.g. a pipe from a script or scheduled task.
+func isInteractive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
 func colored(color lipgloss.Color, s string) string {
 	return lipgloss.NewStyle().Foreground(color).Render(s)
 }
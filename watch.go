@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/fanaticscripter/AtSS/log"
+)
+
+// Interval of the polling fallback, for filesystems where notifications are
+// unreliable. Notified updates refresh the polled state, so that polling
+// doesn't report them again as a separate update.
+const _saveWatcherPollInterval = 30 * time.Second
+
+// saveWatcher calls onUpdate whenever save files in dir are written, created,
+// renamed or removed, including by writing a temporary file and renaming it.
+// The parent directory is watched as well, so that the watch is re-added if
+// dir is removed and recreated, e.g. by Steam Cloud sync.
+type saveWatcher struct {
+	dir      string
+	onUpdate func()
+	watcher  *fsnotify.Watcher
+	// Whether dir itself is currently watched.
+	watching bool
+	// Save files as of the last poll, to detect changes.
+	lastPoll []SaveFile
+}
+
+func newSaveWatcher(dir string, onUpdate func()) (*saveWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create filesystem watcher: %w", err)
+	}
+	dir = filepath.Clean(dir)
+	w := &saveWatcher{dir: dir, onUpdate: onUpdate, watcher: watcher}
+	if err := watcher.Add(filepath.Dir(dir)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch '%s': %w", filepath.Dir(dir), err)
+	}
+	if err := w.addWatch(); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	w.lastPoll = statSaveFiles(dir)
+	return w, nil
+}
+
+func (w *saveWatcher) addWatch() error {
+	if err := w.watcher.Add(w.dir); err != nil {
+		return fmt.Errorf("failed to watch saves directory '%s': %w", w.dir, err)
+	}
+	w.watching = true
+	return nil
+}
+
+// run processes notifications and polls until ctx is done.
+func (w *saveWatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(_saveWatcherPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("filesystem watcher error: %s", err)
+		case <-ticker.C:
+			if !w.watching {
+				w.rewatch()
+			}
+			if files := statSaveFiles(w.dir); !slices.Equal(files, w.lastPoll) {
+				w.lastPoll = files
+				w.onUpdate()
+			}
+		}
+	}
+}
+
+func (w *saveWatcher) handleEvent(event fsnotify.Event) {
+	relevant := fsnotify.Write | fsnotify.Create | fsnotify.Rename | fsnotify.Remove
+	if event.Op&relevant == 0 {
+		return
+	}
+	name := filepath.Clean(event.Name)
+	log.Debugf("filesystem event: %s", event)
+	switch {
+	case name == w.dir:
+		if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+			if w.watching {
+				log.Warnf("saves directory '%s' disappeared, waiting for it to reappear", w.dir)
+			}
+			w.watching = false
+			_ = w.watcher.Remove(w.dir)
+		} else if event.Op&fsnotify.Create != 0 {
+			w.rewatch()
+		}
+	case filepath.Dir(name) == w.dir && filepath.Ext(name) == ".save":
+		w.lastPoll = statSaveFiles(w.dir)
+		w.onUpdate()
+	}
+}
+
+// rewatch re-adds the watch on the saves directory if it exists again.
+func (w *saveWatcher) rewatch() {
+	if stat, err := os.Stat(w.dir); err != nil || !stat.IsDir() {
+		return
+	}
+	if err := w.addWatch(); err != nil {
+		log.Warn(err)
+		return
+	}
+	log.Infof("saves directory '%s' reappeared, watching again", w.dir)
+	// Save files may have been written before the watch was re-added.
+	w.lastPoll = statSaveFiles(w.dir)
+	w.onUpdate()
+}
+
+// statSaveFiles lists the save files in dir with their sizes and modification
+// times; hashes are left out to keep it cheap.
+func statSaveFiles(dir string) []SaveFile {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.save"))
+	files := make([]SaveFile, 0, len(paths))
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		files = append(files, SaveFile{
+			Name:    filepath.Base(path),
+			Size:    stat.Size(),
+			ModTime: stat.ModTime(),
+		})
+	}
+	return files
+}
+
+func (w *saveWatcher) Close() error {
+	return w.watcher.Close()
+}
+
+// saveStabilizer calls fn once the save files have had unchanged sizes and
+// modification times for window after an update, or once maxWait has passed
+// since the first update, whichever comes first. It's an alternative to
+// debouncing on notifications, for saves written in multiple passes.
+type saveStabilizer struct {
+	fn      func()
+	dir     string
+	window  time.Duration
+	maxWait time.Duration
+	flushCh chan struct{}
+
+	mu sync.Mutex
+	// Closed once the pending call is done; nil if there is none.
+	done chan struct{}
+}
+
+func newSaveStabilizer(fn func(), dir string, window, maxWait time.Duration) *saveStabilizer {
+	return &saveStabilizer{
+		fn:      fn,
+		dir:     dir,
+		window:  window,
+		maxWait: maxWait,
+		flushCh: make(chan struct{}),
+	}
+}
+
+// trigger notes an update, starting to wait for stability unless already
+// waiting.
+func (s *saveStabilizer) trigger() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done != nil {
+		return
+	}
+	s.done = make(chan struct{})
+	go s.wait(s.done)
+}
+
+// flush calls fn right away if a call is pending, and waits for it.
+func (s *saveStabilizer) flush() {
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if done == nil {
+		return
+	}
+	select {
+	case s.flushCh <- struct{}{}:
+	case <-done:
+		return
+	}
+	<-done
+}
+
+func (s *saveStabilizer) wait(done chan struct{}) {
+	start := time.Now()
+	stableSince := start
+	last := statSaveFiles(s.dir)
+	ticker := time.NewTicker(max(min(s.window/4, time.Second), 100*time.Millisecond))
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-s.flushCh:
+			break loop
+		case now := <-ticker.C:
+			if files := statSaveFiles(s.dir); !slices.Equal(files, last) {
+				last = files
+				stableSince = now
+			}
+			if now.Sub(stableSince) >= s.window || (s.maxWait > 0 && now.Sub(start) >= s.maxWait) {
+				break loop
+			}
+		}
+	}
+	// Updates from now on start a new wait.
+	s.mu.Lock()
+	s.done = nil
+	s.mu.Unlock()
+	s.fn()
+	close(done)
+}
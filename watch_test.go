@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSaveStabilizer(t *testing.T) {
+	dir := t.TempDir()
+	writeTestSave(t, dir, true, 1, 0)
+	var calls atomic.Int32
+	fn := func() { calls.Add(1) }
+
+	t.Run("calls once stable", func(t *testing.T) {
+		calls.Store(0)
+		s := newSaveStabilizer(fn, dir, 300*time.Millisecond, 0)
+		s.trigger()
+		s.trigger()
+		time.Sleep(100 * time.Millisecond)
+		if n := calls.Load(); n != 0 {
+			t.Fatalf("called %d times before the window passed", n)
+		}
+		time.Sleep(time.Second)
+		if n := calls.Load(); n != 1 {
+			t.Errorf("called %d times, want 1", n)
+		}
+	})
+
+	t.Run("waits while changing", func(t *testing.T) {
+		calls.Store(0)
+		s := newSaveStabilizer(fn, dir, 300*time.Millisecond, 0)
+		s.trigger()
+		for i := 0; i < 6; i++ {
+			writeTestFile(t, filepath.Join(dir, "Save.save"), fmt.Sprintf(`{"gameplay":{"year":%d,"season":0}}`, 10+i))
+			time.Sleep(150 * time.Millisecond)
+			if n := calls.Load(); n != 0 {
+				t.Fatalf("called while the save was still changing")
+			}
+		}
+		time.Sleep(time.Second)
+		if n := calls.Load(); n != 1 {
+			t.Errorf("called %d times, want 1", n)
+		}
+	})
+
+	t.Run("max wait", func(t *testing.T) {
+		calls.Store(0)
+		s := newSaveStabilizer(fn, dir, time.Minute, 300*time.Millisecond)
+		s.trigger()
+		// Stability is checked every second with a long window.
+		time.Sleep(1500 * time.Millisecond)
+		if n := calls.Load(); n != 1 {
+			t.Errorf("called %d times, want 1 after max wait", n)
+		}
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		calls.Store(0)
+		s := newSaveStabilizer(fn, dir, time.Minute, 0)
+		s.flush()
+		if n := calls.Load(); n != 0 {
+			t.Fatalf("flush without a pending update called %d times", n)
+		}
+		s.trigger()
+		s.flush()
+		if n := calls.Load(); n != 1 {
+			t.Fatalf("called %d times after flush, want 1", n)
+		}
+		// Updates after the call start a new wait.
+		s.trigger()
+		s.flush()
+		if n := calls.Load(); n != 2 {
+			t.Errorf("called %d times after second flush, want 2", n)
+		}
+	})
+}